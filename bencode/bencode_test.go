@@ -3,11 +3,18 @@ package bencode
 import (
 	"bytes"
 	"encoding"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/big"
 	"net"
 	"reflect"
+	"strconv"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 type test struct {
@@ -323,6 +330,237 @@ func TestEncodeNil(t *testing.T) {
 	}
 }
 
+var tokenStreamTest = "d3:bari1e3:fool1:ai-2edee0:leei7e4:spami99999999999999999999e"
+
+var tokenStreamWant = []Token{
+	DictStart,
+	String("bar"), Int(1),
+	String("foo"), ListStart, String("a"), Int(-2), DictStart, End, End,
+	String(""), ListStart, End,
+	End,
+	Int(7),
+	String("spam"),
+	Number("99999999999999999999"),
+}
+
+func TestToken(t *testing.T) {
+	dec := NewDecoder(strings.NewReader(tokenStreamTest))
+	for i, want := range tokenStreamWant {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if !reflect.DeepEqual(tok, want) {
+			t.Errorf("#%d: got %#v, want %#v", i, tok, want)
+		}
+	}
+	if tok, err := dec.Token(); err != io.EOF {
+		t.Errorf("got %#v, %v at end of stream, want io.EOF", tok, err)
+	}
+	if n := dec.InputOffset(); n != int64(len(tokenStreamTest)) {
+		t.Errorf("InputOffset: got %d, want %d", n, len(tokenStreamTest))
+	}
+}
+
+func TestTokenPipe(t *testing.T) {
+	r, w := io.Pipe()
+	go func() {
+		for i := 0; i < len(tokenStreamTest); i++ {
+			w.Write([]byte{tokenStreamTest[i]})
+		}
+		w.Close()
+	}()
+
+	dec := NewDecoder(r)
+	for i, want := range tokenStreamWant {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if !reflect.DeepEqual(tok, want) {
+			t.Errorf("#%d: got %#v, want %#v", i, tok, want)
+		}
+	}
+}
+
+func TestTokenDecode(t *testing.T) {
+	in := "d5:itemsld1:ii0e1:m1:aed1:ii1e1:m1:bee4:morei1ee"
+	dec := NewDecoder(strings.NewReader(in))
+
+	want := []Token{DictStart, String("items"), ListStart}
+	for i, w := range want {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("#%d: %s", i, err)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Fatalf("#%d: got %#v, want %#v", i, tok, w)
+		}
+	}
+
+	var items []request
+	for dec.More() {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, req)
+	}
+	if len(items) != 2 || items[0].Method != "a" || items[1].Id != "1" {
+		t.Errorf("decoded %+v", items)
+	}
+
+	if err := dec.Decode(new(interface{})); err == nil {
+		t.Error("Decode at end of list did not fail")
+	}
+}
+
+func TestTokenKeyDecode(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("d1:ai1e1:bi2ee"))
+	if _, err := dec.Token(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(new(interface{})); err == nil {
+		t.Error("Decode of dictionary key did not fail")
+	}
+	if tok, err := dec.Token(); err != nil || !reflect.DeepEqual(tok, String("a")) {
+		t.Fatalf("got %#v, %v", tok, err)
+	}
+	var x int
+	if err := dec.Decode(&x); err != nil || x != 1 {
+		t.Fatalf("got %d, %v", x, err)
+	}
+	if tok, err := dec.Token(); err != nil || !reflect.DeepEqual(tok, String("b")) {
+		t.Fatalf("got %#v, %v", tok, err)
+	}
+}
+
+var tokenErrorTests = []string{
+	"e",
+	"i1x",
+	"li1-2ee",
+	"d1:ae",
+	"li1e",
+	"3:ab",
+}
+
+func TestTokenError(t *testing.T) {
+	for i, in := range tokenErrorTests {
+		dec := NewDecoder(strings.NewReader(in))
+		var err error
+		for err == nil {
+			_, err = dec.Token()
+		}
+		if err == io.EOF {
+			t.Errorf("#%d: %q: Token returned io.EOF", i, in)
+		}
+	}
+
+	// A malformed integer is a syntax error at its offset.
+	dec := NewDecoder(strings.NewReader("li1-2ee"))
+	dec.Token()
+	_, err := dec.Token()
+	if se, ok := err.(*SyntaxError); !ok || se.Offset != 3 {
+		t.Errorf("got %#v, want *SyntaxError at offset 3", err)
+	}
+}
+
+var validTests = []struct {
+	in        string
+	valid     bool
+	canonical bool
+	offset    int64 // of the canonical error
+}{
+	{"i0e", true, true, 0},
+	{"i-1e", true, true, 0},
+	{"i10e", true, true, 0},
+	{"0:", true, true, 0},
+	{"le", true, true, 0},
+	{"de", true, true, 0},
+	{"d0:i1e1:ai2e2:aai3e1:bi4ee", true, true, 0},
+	{"d1:ad1:bi1e1:ci2ee1:bd1:ai1eee", true, true, 0},
+	{"i-0e", true, false, 2},
+	{"i03e", true, false, 2},
+	{"i-03e", true, false, 2},
+	{"03:abc", true, false, 1},
+	{"d01:ai1ee", true, false, 2},
+	{"d1:bi1e1:ai2ee", true, false, 9},
+	{"d1:ai1e1:ai2ee", true, false, 9},
+	{"ld1:bi1ee" + "d1:ai1eee", true, true, 0},
+	{"", false, false, 0},
+	{"i1", false, false, 2},
+	{"li1e", false, false, 4},
+	{"3:ab", false, false, 4},
+	{"i1ei2e", false, false, 3},
+	{"x", false, false, 0},
+	{"ie", false, false, 1},
+	{"i-e", false, false, 2},
+	{"i1-2e", false, false, 2},
+	{"i--5e", false, false, 2},
+}
+
+func TestValid(t *testing.T) {
+	for i, tt := range validTests {
+		err := Valid([]byte(tt.in))
+		if tt.valid != (err == nil) {
+			t.Errorf("#%d: Valid(%q) = %v", i, tt.in, err)
+		}
+
+		err = ValidCanonical([]byte(tt.in))
+		if tt.canonical != (err == nil) {
+			t.Errorf("#%d: ValidCanonical(%q) = %v", i, tt.in, err)
+			continue
+		}
+		if err == nil || !tt.valid {
+			continue
+		}
+		if se, ok := err.(*SyntaxError); !ok {
+			t.Errorf("#%d: ValidCanonical(%q) = %#v, want *SyntaxError", i, tt.in, err)
+		} else if se.Offset != tt.offset {
+			t.Errorf("#%d: ValidCanonical(%q) offset %d, want %d", i, tt.in, se.Offset, tt.offset)
+		}
+	}
+}
+
+func TestStringLenOverflow(t *testing.T) {
+	for _, in := range []string{"99999999999999999999:", "d99999999999999999999:"} {
+		err := Valid([]byte(in))
+		if se, ok := err.(*SyntaxError); !ok || se.Offset != int64(strings.Index(in, "9")+18) {
+			t.Errorf("Valid(%q) = %#v, want *SyntaxError at the 19th digit", in, err)
+		}
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	for i, tt := range validTests {
+		if !tt.valid {
+			continue
+		}
+		dec := NewDecoder(strings.NewReader(tt.in))
+		dec.Strict()
+		var v interface{}
+		err := dec.Decode(&v)
+		if tt.canonical {
+			if err != nil {
+				t.Errorf("#%d: %q: %s", i, tt.in, err)
+			}
+			continue
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("#%d: %q: got %#v, want *SyntaxError", i, tt.in, err)
+		}
+
+		dec = NewDecoder(strings.NewReader(tt.in))
+		dec.Strict()
+		for err = nil; err == nil; {
+			_, err = dec.Token()
+		}
+		if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("#%d: %q: Token got %#v, want *SyntaxError", i, tt.in, err)
+		}
+	}
+}
+
 type benchmarkStruct struct {
 	Q      string      `bencode:"q"`
 	AQ     string      `bencode:"aq,omitempty"`
@@ -337,9 +575,1048 @@ var benchmarkTest = []byte("d1:q4:auth2:aq4:ping6:cookie10:13536270564:hash64:d1
 func BenchmarkUnmarshal(b *testing.B) {
 	x := new(benchmarkStruct)
 	var err error
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		if err = Unmarshal(benchmarkTest, x); err != nil {
 			b.Fatal(err.Error())
 		}
 	}
 }
+
+// benchmarkBytes has the fields of benchmarkStruct as byte strings,
+// which UnmarshalBorrow does not copy.
+type benchmarkBytes struct {
+	Q      []byte     `bencode:"q"`
+	AQ     []byte     `bencode:"aq,omitempty"`
+	Cookie []byte     `bencode:"cookie,omitempty"`
+	Hash   []byte     `bencode:"hash,omitempty"`
+	Args   RawMessage `bencode:"args,omitempty"`
+	Txid   []byte     `bencode:"txid"`
+}
+
+func BenchmarkUnmarshalBytes(b *testing.B) {
+	benchmarkUnmarshalBytes(b, Unmarshal)
+}
+
+func BenchmarkUnmarshalBorrow(b *testing.B) {
+	benchmarkUnmarshalBytes(b, UnmarshalBorrow)
+}
+
+func benchmarkUnmarshalBytes(b *testing.B, unmarshal func([]byte, interface{}) error) {
+	var x benchmarkBytes
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		x = benchmarkBytes{}
+		if err := unmarshal(benchmarkTest, &x); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+type rawFields struct {
+	A RawMessage  `bencode:"a"`
+	B *RawMessage `bencode:"b"`
+	C int         `bencode:"c"`
+}
+
+func TestRawMessageField(t *testing.T) {
+	in := []byte("d1:ali1e0:e1:b3:xyz1:ci5ee")
+	var r rawFields
+	if err := Unmarshal(in, &r); err != nil {
+		t.Fatal(err)
+	}
+	if string(r.A) != "li1e0:e" || r.B == nil || string(*r.B) != "3:xyz" || r.C != 5 {
+		t.Fatalf("got %q %q %d", r.A, r.B, r.C)
+	}
+
+	out, err := Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, in) {
+		t.Errorf("got %q, want %q", out, in)
+	}
+}
+
+func TestBorrow(t *testing.T) {
+	in := []byte("d1:a2:xy1:bli1ee1:cl1:zee")
+	var copied, borrowed struct {
+		A []byte      `bencode:"a"`
+		B RawMessage  `bencode:"b"`
+		C interface{} `bencode:"c"`
+	}
+	if err := Unmarshal(in, &copied); err != nil {
+		t.Fatal(err)
+	}
+	if err := UnmarshalBorrow(in, &borrowed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(borrowed, copied) {
+		t.Fatalf("got %+v, want %+v", borrowed, copied)
+	}
+
+	// Appending must not write over the data that follows.
+	_ = append(borrowed.A, '!')
+	_ = append(borrowed.B, '!')
+	if string(in) != "d1:a2:xy1:bli1ee1:cl1:zee" {
+		t.Fatalf("append changed data to %q", in)
+	}
+
+	// Only the borrowed values see changes to the data.
+	copy(in, "d1:a2:XY1:bli2ee1:cl1:Zee")
+	if string(copied.A) != "xy" || string(copied.B) != "li1ee" || string(copied.C.([]interface{})[0].([]byte)) != "z" {
+		t.Errorf("copies changed: %+v", copied)
+	}
+	if string(borrowed.A) != "XY" || string(borrowed.B) != "li2ee" || string(borrowed.C.([]interface{})[0].([]byte)) != "Z" {
+		t.Errorf("borrowed values unchanged: %+v", borrowed)
+	}
+}
+
+func TestDecoderBorrow(t *testing.T) {
+	// Read a byte at a time so that the buffer fills up and grows
+	// while earlier values still refer to it.
+	var in bytes.Buffer
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&in, "d1:a%d:%de", len(strconv.Itoa(i)), i)
+	}
+	dec := NewDecoder(iotest.OneByteReader(&in))
+	dec.Borrow()
+	var got []RawMessage
+	for {
+		var raw RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, raw)
+	}
+	if len(got) != 200 {
+		t.Fatalf("decoded %d values, want 200", len(got))
+	}
+	for i, raw := range got {
+		if want := fmt.Sprintf("d1:a%d:%de", len(strconv.Itoa(i)), i); string(raw) != want {
+			t.Errorf("#%d: got %q, want %q", i, raw, want)
+		}
+	}
+}
+
+func TestNilPointerDict(t *testing.T) {
+	var out nestA
+	if err := Unmarshal([]byte("d1:Ai1e1:Cd1:Di2e1:Fd1:Bi3eee1:Ei4ee"), &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.A != 1 || out.C == nil || out.C.D != 2 || out.C.F == nil || out.C.F.B != 3 {
+		t.Errorf("got %+v, C %+v", out, out.C)
+	}
+	if out.C.F.C != nil {
+		t.Errorf("absent pointer allocated: %+v", out.C.F.C)
+	}
+}
+
+var splitTests = []struct {
+	in, value, rest string
+	ok              bool
+}{
+	{"i5e", "i5e", "", true},
+	{"i-12exyz", "i-12e", "xyz", true},
+	{"3:abc3:def", "3:abc", "3:def", true},
+	{"0:", "0:", "", true},
+	{"0:i1e", "0:", "i1e", true},
+	{"le\x00\x01", "le", "\x00\x01", true},
+	{"d1:ad1:bi1eee\xffpayload", "d1:ad1:bi1eee", "\xffpayload", true},
+	{"d1:ai1e", "", "", false},
+	{"4:abc", "", "", false},
+	{"", "", "", false},
+	{"x", "", "", false},
+}
+
+func TestSplitValue(t *testing.T) {
+	for _, tt := range splitTests {
+		value, rest, err := SplitValue([]byte(tt.in))
+		if (err == nil) != tt.ok {
+			t.Errorf("SplitValue(%q): error %v", tt.in, err)
+			continue
+		}
+		if string(value) != tt.value || string(rest) != tt.rest {
+			t.Errorf("SplitValue(%q) = %q, %q; want %q, %q", tt.in, value, rest, tt.value, tt.rest)
+		}
+	}
+}
+
+func TestUnmarshalPrefix(t *testing.T) {
+	var v struct {
+		Type  int `bencode:"msg_type"`
+		Piece int `bencode:"piece"`
+	}
+	rest, err := UnmarshalPrefix([]byte("d8:msg_typei1e5:piecei2eed5:fake!e"), &v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.Type != 1 || v.Piece != 2 || string(rest) != "d5:fake!e" {
+		t.Errorf("got %+v, rest %q", v, rest)
+	}
+
+	var s string
+	if rest, err = UnmarshalPrefix([]byte("3:abc3:def"), &s); err != nil || s != "abc" || string(rest) != "3:def" {
+		t.Errorf("string: got %q, rest %q, %v", s, rest, err)
+	}
+
+	var n int
+	rest, err = UnmarshalPrefix([]byte("le\x01\x02"), &n)
+	if _, ok := err.(*UnmarshalTypeError); !ok || string(rest) != "\x01\x02" {
+		t.Errorf("type error: got rest %q, %v", rest, err)
+	}
+	if _, err = UnmarshalPrefix([]byte("d1:a"), &v); err == nil {
+		t.Error("truncated value: no error")
+	}
+}
+
+// mixedStream alternates bencoded headers with raw payloads,
+// the length of each given by its header.
+const mixedStream = "d3:leni4ee\x00e\xffdd3:leni0eed3:leni3eexyzi7e"
+
+func TestDecoderRemainder(t *testing.T) {
+	for _, slow := range []bool{false, true} {
+		var r io.Reader = strings.NewReader(mixedStream)
+		if slow {
+			r = iotest.OneByteReader(r)
+		}
+		dec := NewDecoder(r)
+		var payloads []string
+		for i := 0; i < 3; i++ {
+			var h struct {
+				Len int `bencode:"len"`
+			}
+			if err := dec.Decode(&h); err != nil {
+				t.Fatalf("slow=%v: header %d: %s", slow, i, err)
+			}
+			p := make([]byte, h.Len)
+			if _, err := io.ReadFull(dec.Remainder(), p); err != nil {
+				t.Fatalf("slow=%v: payload %d: %s", slow, i, err)
+			}
+			payloads = append(payloads, string(p))
+		}
+		if want := []string{"\x00e\xffd", "", "xyz"}; !reflect.DeepEqual(payloads, want) {
+			t.Errorf("slow=%v: got payloads %q, want %q", slow, payloads, want)
+		}
+
+		var n int
+		if err := dec.Decode(&n); err != nil || n != 7 {
+			t.Errorf("slow=%v: trailing value: got %d, %v", slow, n, err)
+		}
+		if off := dec.InputOffset(); off != int64(len(mixedStream)) {
+			t.Errorf("slow=%v: InputOffset %d, want %d", slow, off, len(mixedStream))
+		}
+		if b, err := ioutil.ReadAll(dec.Remainder()); len(b) != 0 || err != nil {
+			t.Errorf("slow=%v: remainder at end: %q, %v", slow, b, err)
+		}
+	}
+}
+
+var limitTests = []struct {
+	in     string
+	opts   DecoderOptions
+	limit  string
+	offset int64
+}{
+	{"lllleeee", DecoderOptions{MaxDepth: 3}, "MaxDepth", 3},
+	{"d1:ald1:bleee", DecoderOptions{MaxDepth: 2}, "MaxDepth", 5},
+	{"lllleeee", DecoderOptions{MaxDepth: 4}, "", 0},
+	{"9999999999:", DecoderOptions{MaxStringLength: 1 << 20}, "MaxStringLength", 6},
+	{"l3:abc4:abcde", DecoderOptions{MaxStringLength: 3}, "MaxStringLength", 7},
+	{"d4:abcdi1ee", DecoderOptions{MaxStringLength: 3}, "MaxStringLength", 2},
+	{"li1ei2ei3ee", DecoderOptions{MaxElements: 2}, "MaxElements", 7},
+	{"d1:ai1e1:bi2e1:ci3ee", DecoderOptions{MaxElements: 2}, "MaxElements", 13},
+	{"li1eli2ei3eee", DecoderOptions{MaxElements: 2}, "", 0},
+	{"li1ei2ei3ee", DecoderOptions{MaxValueSize: 8}, "MaxValueSize", 8},
+	{"l100:", DecoderOptions{MaxValueSize: 64}, "MaxValueSize", 64},
+	{"li1ei2ei3ee", DecoderOptions{MaxValueSize: 11}, "", 0},
+}
+
+func TestDecoderLimits(t *testing.T) {
+	for _, tt := range limitTests {
+		dec := NewDecoder(strings.NewReader(tt.in))
+		dec.SetOptions(tt.opts)
+		var v interface{}
+		err := dec.Decode(&v)
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%q %+v: %s", tt.in, tt.opts, err)
+			}
+			continue
+		}
+		le, ok := err.(*LimitError)
+		if !ok || le.Limit != tt.limit || le.Offset != tt.offset {
+			t.Errorf("%q %+v: got %v, want %s at offset %d", tt.in, tt.opts, err, tt.limit, tt.offset)
+		}
+	}
+}
+
+func TestTokenLimits(t *testing.T) {
+	dec := NewDecoder(strings.NewReader("ll3:abcel1:a1:b1:cee"))
+	dec.SetOptions(DecoderOptions{MaxDepth: 2, MaxElements: 2})
+	var err error
+	for i := 0; err == nil && i < 20; i++ {
+		_, err = dec.Token()
+	}
+	if le, ok := err.(*LimitError); !ok || le.Limit != "MaxElements" || le.Offset != 15 {
+		t.Errorf("got %v, want MaxElements at offset 15", err)
+	}
+}
+
+func TestStringLengthOverflow(t *testing.T) {
+	for _, in := range []string{"99999999999999999999999:", "d99999999999999999999999:e"} {
+		if err := Valid([]byte(in)); err == nil {
+			t.Errorf("Valid(%q): no error", in)
+		}
+		var v interface{}
+		if err := Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("Unmarshal(%q): no error", in)
+		}
+	}
+}
+
+// topLevelStream holds values of every type back to back,
+// with a string longer than the Decoder's first read.
+var topLevelStream = "3:abc0:i5e4:spamli1ee1000:" + strings.Repeat("x", 1000) + "d1:a1:be2:zz"
+
+func TestDecodeTopLevel(t *testing.T) {
+	want := []interface{}{
+		[]byte("abc"), []byte{}, int64(5), []byte("spam"), []interface{}{int64(1)},
+		bytes.Repeat([]byte("x"), 1000), map[string]interface{}{"a": []byte("b")}, []byte("zz"),
+	}
+	for _, slow := range []bool{false, true} {
+		var r io.Reader = strings.NewReader(topLevelStream)
+		if slow {
+			r = iotest.OneByteReader(r)
+		}
+		dec := NewDecoder(r)
+		var got []interface{}
+		for {
+			var v interface{}
+			err := dec.Decode(&v)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("slow=%v: value %d: %s", slow, len(got), err)
+			}
+			got = append(got, v)
+		}
+		// Values decoded earlier must not share the Decoder's buffer.
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("slow=%v: got %q\nwant %q", slow, got, want)
+		}
+		if off := dec.InputOffset(); off != int64(len(topLevelStream)) {
+			t.Errorf("slow=%v: InputOffset %d", slow, off)
+		}
+	}
+
+	dec := NewDecoder(strings.NewReader("5:abc"))
+	var s string
+	if err := dec.Decode(&s); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated string: got %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// A torrent with non-canonical integers and keys out of order.
+var valueTorrent = "d8:announce14:http://a/trk/x4:infod6:lengthi03e4:name1:f12:piece lengthi-0e6:pieces0:e1:0le7:comment0:e"
+
+func TestValueRoundTrip(t *testing.T) {
+	for _, in := range []string{valueTorrent, "i-0e", "04:spam", "le", "d2:ab0:1:a02:xxe", "li99999999999999999999ee"} {
+		v, err := Parse([]byte(in))
+		if err != nil {
+			t.Errorf("Parse(%q): %s", in, err)
+			continue
+		}
+		if b := v.Encode(); string(b) != in {
+			t.Errorf("Encode: got %q, want %q", b, in)
+		}
+	}
+	for _, in := range []string{"", "i1ei2e", "d1:ai1e", "i1-2e"} {
+		if _, err := Parse([]byte(in)); err == nil {
+			t.Errorf("Parse(%q) succeeded", in)
+		}
+	}
+}
+
+func TestValueNumber(t *testing.T) {
+	v, err := Parse([]byte("li99999999999999999999ei-7ee"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i, n := v.Index(0).Int(), v.Index(0).Number(); i != 0 || n != "99999999999999999999" {
+		t.Errorf("got %d and %q", i, n)
+	}
+	if i, n := v.Index(1).Int(), v.Index(1).Number(); i != -7 || n != "-7" {
+		t.Errorf("got %d and %q", i, n)
+	}
+	if n := NewInt(12).Number(); n != "12" {
+		t.Errorf("NewInt: got %q", n)
+	}
+	if n := NewString("12").Number(); n != "" {
+		t.Errorf("NewString: got %q", n)
+	}
+}
+
+func TestValueEdit(t *testing.T) {
+	v, err := Parse([]byte(valueTorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := v.Lookup("info").Encode()
+
+	if got := string(v.Lookup("info", "name").Bytes()); got != "f" {
+		t.Errorf("info.name: got %q", got)
+	}
+	if got := v.Lookup("info", "length").Int(); got != 3 {
+		t.Errorf("info.length: got %d", got)
+	}
+	for _, path := range [][]interface{}{{"x"}, {"info", 0}, {"0", 0}, {"announce", "a"}} {
+		if got := v.Lookup(path...); got != nil {
+			t.Errorf("Lookup%v: got %q", path, got.Encode())
+		}
+	}
+
+	tiers, err := NewValue([][]string{{"http://a/trk/x"}, {"udp://b:80"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Set("announce-list", tiers)
+	v.Lookup("announce-list", 1).Append(NewString("udp://c:80"))
+	v.Lookup("comment").SetString("hi")
+	v.Delete("0")
+
+	want := "d8:announce14:http://a/trk/x13:announce-listll14:http://a/trk/xel10:udp://b:8010:udp://c:80ee" +
+		"4:infod6:lengthi03e4:name1:f12:piece lengthi-0e6:pieces0:e7:comment2:hie"
+	if b := v.Encode(); string(b) != want {
+		t.Errorf("got  %q\nwant %q", b, want)
+	}
+	if b := v.Lookup("info").Encode(); !bytes.Equal(b, info) {
+		t.Errorf("info changed: %q", b)
+	}
+	if keys := v.Keys(); !reflect.DeepEqual(keys, []string{"announce", "announce-list", "info", "comment"}) {
+		t.Errorf("keys: %q", keys)
+	}
+
+	if err := v.Append(NewInt(1)); err == nil {
+		t.Error("Append to a dictionary succeeded")
+	}
+	if err := tiers.SetIndex(2, NewList()); err == nil {
+		t.Error("SetIndex out of range succeeded")
+	}
+}
+
+func TestValueField(t *testing.T) {
+	var x struct {
+		A int
+		B Value
+	}
+	in := "d1:Ai1e1:Bd1:zi0e1:ai0eee"
+	if err := Unmarshal([]byte(in), &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.B.Kind() != KindDict || x.B.Len() != 2 {
+		t.Fatalf("got %v of length %d", x.B.Kind(), x.B.Len())
+	}
+	b, err := Marshal(x)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != in {
+		t.Errorf("Marshal: got %q, want %q", b, in)
+	}
+
+	var m map[string]int
+	if err := x.B.Decode(&m); err != nil || m["z"] != 0 || len(m) != 2 {
+		t.Errorf("Decode: got %v, %v", m, err)
+	}
+}
+
+var lookupDoc = []byte("d8:announce3:url4:infod5:filesld6:lengthi1e4:pathl1:aeed6:lengthi2e4:pathl1:b1:ceee" +
+	"4:name4:test12:piece lengthi16384e6:pieces0:ee")
+
+func TestLookup(t *testing.T) {
+	if got := Lookup(lookupDoc, "info", "files", 1, "path"); string(got) != "l1:b1:ce" {
+		t.Errorf("Lookup info.files[1].path: got %q", got)
+	}
+	if got := Lookup(lookupDoc); string(got) != string(lookupDoc) {
+		t.Errorf("Lookup with empty path: got %q", got)
+	}
+	if got := Lookup(lookupDoc, "info", "files", 2); got != nil {
+		t.Errorf("Lookup past end of list: got %q", got)
+	}
+	if got := Lookup([]byte("d1:ai1e"), "b"); got != nil {
+		t.Errorf("Lookup in truncated input: got %q", got)
+	}
+
+	if s, err := LookupString(lookupDoc, "info", "name"); s != "test" || err != nil {
+		t.Errorf("LookupString: got %q, %v", s, err)
+	}
+	if n, err := LookupInt(lookupDoc, "info", "piece length"); n != 16384 || err != nil {
+		t.Errorf("LookupInt: got %d, %v", n, err)
+	}
+	if n, err := LookupInt(lookupDoc, "info", "files", 1, "length"); n != 2 || err != nil {
+		t.Errorf("LookupInt: got %d, %v", n, err)
+	}
+
+	for _, tt := range []struct {
+		path []interface{}
+		err  string
+	}{
+		{[]interface{}{"info", "nome"}, `bencode: key "nome" not found in info`},
+		{[]interface{}{"info", "files", 5, "length"}, "bencode: index 5 out of range in info.files"},
+		{[]interface{}{"announce", 0}, "bencode: announce is not a list"},
+		{[]interface{}{"info", "files", 0, "path", "x"}, "bencode: info.files[0].path is not a dictionary"},
+		{[]interface{}{"info", "name"}, "bencode: info.name is not an integer"},
+		{[]interface{}{"info", 1.5}, "bencode: invalid path element ?"},
+	} {
+		_, err := LookupInt(lookupDoc, tt.path...)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("LookupInt%v: got error %v, want %s", tt.path, err, tt.err)
+		}
+	}
+	if _, err := LookupString(lookupDoc, "info", "piece length"); err == nil {
+		t.Error("LookupString of an integer succeeded")
+	}
+}
+
+func TestLookupAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations depend on sync.Pool, which the race detector disturbs")
+	}
+	for _, path := range [][]interface{}{{"announce"}, {"info", "pieces"}, {"info", "files", 1, "path"}} {
+		if n := testing.AllocsPerRun(10, func() { Lookup(lookupDoc, path...) }); n != 0 {
+			t.Errorf("Lookup%v: got %v allocations, want 0", path, n)
+		}
+	}
+}
+
+type RestBase struct {
+	Extra map[string]RawMessage `bencode:",rest"`
+}
+
+type restOuter struct {
+	*RestBase
+	Name   string `bencode:"name"`
+	Pieces []byte `bencode:"pieces,omitempty"`
+}
+
+type embedInner struct {
+	X int `bencode:"x"`
+}
+
+type embedOuter struct {
+	*embedInner
+	Y int `bencode:"y"`
+}
+
+func TestUnexportedEmbeddedPointer(t *testing.T) {
+	var v embedOuter
+	err := Unmarshal([]byte("d1:xi1e1:yi2ee"), &v)
+	if err == nil || err.Error() != "bencode: x: cannot set embedded pointer to unexported struct: bencode.embedInner" {
+		t.Errorf("got %v, want an error about the embedded pointer", err)
+	}
+	if v.embedInner != nil || v.Y != 2 {
+		t.Errorf("got %+v", v)
+	}
+
+	// An embedded pointer that is set is used.
+	v = embedOuter{embedInner: new(embedInner)}
+	if err = Unmarshal([]byte("d1:xi1e1:yi2ee"), &v); err != nil || v.X != 1 || v.Y != 2 {
+		t.Errorf("got %+v, %v", v, err)
+	}
+	if b, err := Marshal(v); err != nil || string(b) != "d1:xi1e1:yi2ee" {
+		t.Errorf("Marshal: got %s, %v", b, err)
+	}
+}
+
+func TestRest(t *testing.T) {
+	in := "d1:ai1e4:name1:x5:otherli1ee6:pieces1:p1:zd1:ai2eee"
+	var v restOuter
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]RawMessage{"a": RawMessage("i1e"), "other": RawMessage("li1ee"), "z": RawMessage("d1:ai2ee")}
+	if v.RestBase == nil || !reflect.DeepEqual(v.Extra, want) {
+		t.Fatalf("got %+v, want Extra %q", v, want)
+	}
+	if v.Name != "x" || string(v.Pieces) != "p" {
+		t.Errorf("got name %q and pieces %q", v.Name, v.Pieces)
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("Marshal:\ngot  %s\nwant %s", out, in)
+	}
+
+	// A field wins over a rest key of the same name.
+	v.Extra["name"] = RawMessage("1:y")
+	v.Pieces = nil
+	out, err = Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d1:ai1e4:name1:x5:otherli1ee1:zd1:ai2eee"; string(out) != want {
+		t.Errorf("Marshal:\ngot  %s\nwant %s", out, want)
+	}
+}
+
+func TestDisallowUnknownFields(t *testing.T) {
+	in := "d1:Ai1e1:Xi2e1:Bi3ee"
+	var c cooked
+	dec := NewDecoder(strings.NewReader(in))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(&c)
+	if err == nil || err.Error() != `bencode: unknown field "X"` {
+		t.Errorf("got error %v", err)
+	}
+	// The rest of the value is still decoded.
+	if c.A != 1 || c.B != 3 {
+		t.Errorf("got %+v", c)
+	}
+
+	var r restOuter
+	dec = NewDecoder(strings.NewReader(in))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&r); err != nil {
+		t.Errorf("with rest field: %v", err)
+	}
+	if len(r.Extra) != 3 {
+		t.Errorf("got %q", r.Extra)
+	}
+}
+
+type bigInts struct {
+	ID    *big.Int `bencode:"id"`
+	Value big.Int  `bencode:"value"`
+	N     Number   `bencode:"n"`
+	Nil   *big.Int `bencode:"nil,omitempty"`
+}
+
+func TestBigInt(t *testing.T) {
+	in := "d2:idi340282366920938463463374607431768211455e1:ni-99999999999999999999e5:valuei-1ee"
+	var v bigInts
+	if err := Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.ID == nil || v.ID.String() != "340282366920938463463374607431768211455" {
+		t.Errorf("got id %v", v.ID)
+	}
+	if v.Value.Int64() != -1 || v.N != "-99999999999999999999" {
+		t.Errorf("got value %v and n %q", &v.Value, v.N)
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != in {
+		t.Errorf("Marshal:\ngot  %s\nwant %s", out, in)
+	}
+	// An earlier version encoded a big.Int as text.
+	if err = Unmarshal([]byte("d2:id3:123e"), &v); err != nil || v.ID.Int64() != 123 {
+		t.Errorf("got %v, %v", v.ID, err)
+	}
+	if err = Unmarshal([]byte("d1:n1:1e"), &v); err == nil {
+		t.Error("decoded a string into a Number")
+	}
+	// The scanner accepts these, but they are not numbers.
+	for _, in := range []string{"d5:valuei1-2ee", "d5:valuei--ee"} {
+		if err = Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("%s: got %v, want error", in, &v.Value)
+		}
+		dec := NewDecoder(strings.NewReader(in))
+		dec.UseBigInt()
+		var x interface{}
+		if err = dec.Decode(&x); err == nil {
+			t.Errorf("%s: UseBigInt got %v, want error", in, x)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	for _, tt := range []struct {
+		n   Number
+		out string
+	}{
+		{"", "i0e"},
+		{"12", "i12e"},
+		{"-3", "i-3e"},
+		{"1e2:xx", ""},
+		{"x", ""},
+		{"1-2", ""},
+		{"-", ""},
+		{"--5", ""},
+		{"-0", ""},
+		{"03", ""},
+		{"0", "i0e"},
+	} {
+		out, err := Marshal(tt.n)
+		if tt.out == "" {
+			if err == nil {
+				t.Errorf("Marshal(%q): got %s, want error", tt.n, out)
+			}
+			continue
+		}
+		if err != nil || string(out) != tt.out {
+			t.Errorf("Marshal(%q): got %s, %v, want %s", tt.n, out, err, tt.out)
+		}
+	}
+	if i, err := Number("-7").Int64(); i != -7 || err != nil {
+		t.Errorf("Int64: got %d, %v", i, err)
+	}
+	if _, err := Number("1.5").BigInt(); err == nil {
+		t.Error("BigInt: no error for 1.5")
+	}
+
+	for _, in := range []string{"i--5e", "i1-2e", "i-0e", "i03e", "i-e"} {
+		var n Number
+		if err := n.UnmarshalBencode([]byte(in)); err == nil {
+			t.Errorf("UnmarshalBencode(%q): got %q, want error", in, n)
+		}
+	}
+	var n Number
+	if err := Unmarshal([]byte("i-12e"), &n); err != nil || n != "-12" {
+		t.Errorf("Unmarshal: got %q, %v", n, err)
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	in := "li1ei99999999999999999999ee"
+	var v interface{}
+	if err := Unmarshal([]byte(in), &v); err == nil {
+		t.Errorf("got %v, want error", v)
+	}
+
+	dec := NewDecoder(strings.NewReader(in))
+	dec.UseBigInt()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	l := v.([]interface{})
+	if n, ok := l[0].(int64); !ok || n != 1 {
+		t.Errorf("got %T %v, want int64 1", l[0], l[0])
+	}
+	if z, ok := l[1].(*big.Int); !ok || z.String() != "99999999999999999999" {
+		t.Errorf("got %T %v, want *big.Int", l[1], l[1])
+	}
+
+	dec = NewDecoder(strings.NewReader(in))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	if want := []interface{}{Number("1"), Number("99999999999999999999")}; !reflect.DeepEqual(v, want) {
+		t.Errorf("got %#v, want %#v", v, want)
+	}
+}
+
+func TestEncoderWrite(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	check := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(enc.BeginDict())
+	check(enc.WriteKey("a"))
+	check(enc.WriteInt(-1))
+	check(enc.WriteKey("b"))
+	check(enc.BeginList())
+	check(enc.WriteString("x"))
+	check(enc.WriteBytes([]byte{0}))
+	check(enc.Encode(cooked{1, 2, 3}))
+	check(enc.Encode(RawMessage("le")))
+	// Nothing is held back.
+	if want := "d1:ai-1e1:bl1:x1:\x00d1:Ai1e1:Bi2e1:Ci3eele"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+	check(enc.End())
+	check(enc.WriteKey("c"))
+	check(enc.Encode(Number("99999999999999999999")))
+	check(enc.End())
+	check(enc.WriteInt(5))
+	if want := "d1:ai-1e1:bl1:x1:\x00d1:Ai1e1:Bi2e1:Ci3eelee1:ci99999999999999999999eei5e"; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
+
+var encoderMisuseTests = []struct {
+	write func(*Encoder) error
+	err   string
+}{
+	{func(enc *Encoder) error { return enc.End() }, "End called outside a list or dictionary"},
+	{func(enc *Encoder) error { return enc.WriteKey("a") }, "WriteKey called outside a dictionary"},
+	{func(enc *Encoder) error {
+		enc.BeginList()
+		return enc.WriteKey("a")
+	}, "WriteKey called outside a dictionary"},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		return enc.WriteInt(1)
+	}, "value written while expecting a dictionary key"},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		return enc.Encode("x")
+	}, "value written while expecting a dictionary key"},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		enc.WriteKey("a")
+		return enc.WriteKey("b")
+	}, "WriteKey called while expecting a dictionary value"},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		enc.WriteKey("a")
+		return enc.End()
+	}, "End called while expecting a dictionary value"},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		enc.WriteKey("b")
+		enc.WriteInt(1)
+		return enc.WriteKey("a")
+	}, `unsorted dictionary key "a"`},
+	{func(enc *Encoder) error {
+		enc.BeginDict()
+		enc.WriteKey("a")
+		enc.WriteInt(1)
+		return enc.WriteKey("a")
+	}, `duplicate dictionary key "a"`},
+}
+
+func TestEncoderMisuse(t *testing.T) {
+	for i, tt := range encoderMisuseTests {
+		var buf bytes.Buffer
+		err := tt.write(NewEncoder(&buf))
+		if err == nil || err.Error() != "bencode: "+tt.err {
+			t.Errorf("#%d: got error %v, want %s", i, err, tt.err)
+		}
+	}
+
+	// A write error sticks.
+	r, w := io.Pipe()
+	r.Close()
+	enc := NewEncoder(w)
+	if err := enc.BeginList(); err != io.ErrClosedPipe {
+		t.Errorf("got %v", err)
+	}
+	if err := enc.End(); err != io.ErrClosedPipe {
+		t.Errorf("got %v after a write error", err)
+	}
+}
+
+type optionFields struct {
+	Flag    bool       `bencode:"flag"`
+	Created time.Time  `bencode:"creation date,omitempty"`
+	Updated time.Time  `bencode:"updated,unixms"`
+	Port    uint16     `bencode:"port,string"`
+	Offset  *int       `bencode:"offset,string,omitempty"`
+	Ratio   float64    `bencode:"ratio,string"`
+	Small   float32    `bencode:"small,string"`
+	Seen    *time.Time `bencode:"seen,unixms,omitempty"`
+}
+
+func TestTagOptions(t *testing.T) {
+	off := -3
+	seen := time.Unix(-2, 5e8)
+	v := optionFields{
+		Flag:    true,
+		Created: time.Unix(1400000000, 999),
+		Updated: time.Unix(1400000000, 123456789),
+		Port:    6881,
+		Offset:  &off,
+		Ratio:   1.5,
+		Small:   0.1,
+		Seen:    &seen,
+	}
+	want := "d13:creation datei1400000000e4:flagi1e6:offset2:-34:port4:68815:ratio3:1.54:seeni-1500e5:small3:0.17:updatedi1400000000123ee"
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("Marshal:\ngot  %s\nwant %s", out, want)
+	}
+
+	var got optionFields
+	if err = Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Flag || got.Port != 6881 || got.Offset == nil || *got.Offset != -3 || got.Ratio != 1.5 || got.Small != 0.1 {
+		t.Errorf("got %+v", got)
+	}
+	if !got.Created.Equal(time.Unix(1400000000, 0)) {
+		t.Errorf("got creation date %v", got.Created)
+	}
+	if !got.Updated.Equal(time.Unix(1400000000, 123e6)) {
+		t.Errorf("got updated %v", got.Updated)
+	}
+	if got.Seen == nil || !got.Seen.Equal(seen) {
+		t.Errorf("got seen %v", got.Seen)
+	}
+
+	// Empty values are left out.
+	out, err = Marshal(optionFields{Updated: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d4:flagi0e4:port1:05:ratio1:05:small1:07:updatedi0ee"; string(out) != want {
+		t.Errorf("Marshal:\ngot  %s\nwant %s", out, want)
+	}
+
+	// Integers decode into fields with the string option,
+	// and text into time pointers.
+	in := "d4:porti80e5:ratioi2e4:seen20:2014-05-13T16:53:20Ze"
+	if err = Unmarshal([]byte(in), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Port != 80 || got.Ratio != 2 || got.Seen.Unix() != 1400000000 {
+		t.Errorf("got %+v", got)
+	}
+
+	for _, in := range []string{"d4:port2:-1e", "d4:port5:70000e", "d5:ratio1:xe"} {
+		if err := Unmarshal([]byte(in), &got); err == nil {
+			t.Errorf("Unmarshal(%q): no error", in)
+		}
+	}
+	if _, err := Marshal(struct{ F float64 }{1}); err == nil {
+		t.Error("Marshal of a float64 field without the string option: no error")
+	}
+}
+
+// textKey is a map key that is encoded as text.
+type textKey struct{ a, b byte }
+
+func (k textKey) MarshalText() ([]byte, error) { return []byte{k.a, '-', k.b}, nil }
+
+func (k *textKey) UnmarshalText(b []byte) error {
+	if len(b) != 3 || b[1] != '-' {
+		return fmt.Errorf("invalid key %q", b)
+	}
+	k.a, k.b = b[0], b[2]
+	return nil
+}
+
+// keyByte is a named byte type, of which arrays are map keys.
+type keyByte byte
+
+func TestMapKeys(t *testing.T) {
+	var hash [4]byte
+	copy(hash[:], "\xff\x00ab")
+	for _, tt := range []struct {
+		m   interface{}
+		out string
+	}{
+		{map[int]string{9: "a", 10: "b", -1: "c"}, "d2:-11:c2:101:b1:91:ae"},
+		{map[uint8]int{255: 1, 0: 2}, "d1:0i2e3:255i1ee"},
+		{map[[4]byte]int{hash: 1, {'a'}: 2}, "d4:a\x00\x00\x00i2e4:\xff\x00abi1ee"},
+		{map[textKey]int{{'b', 'a'}: 1, {'a', 'z'}: 2}, "d3:a-zi2e3:b-ai1ee"},
+		{map[[2]keyByte]int{{'x', 'y'}: 1}, "d2:xyi1ee"},
+	} {
+		out, err := Marshal(tt.m)
+		if err != nil {
+			t.Errorf("Marshal(%v): %v", tt.m, err)
+			continue
+		}
+		if string(out) != tt.out {
+			t.Errorf("Marshal(%v):\ngot  %q\nwant %q", tt.m, out, tt.out)
+		}
+		v := reflect.New(reflect.TypeOf(tt.m))
+		if err = Unmarshal(out, v.Interface()); err != nil {
+			t.Errorf("Unmarshal(%q): %v", out, err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Elem().Interface(), tt.m) {
+			t.Errorf("Unmarshal(%q): got %v, want %v", out, v.Elem(), tt.m)
+		}
+	}
+
+	for _, tt := range []struct {
+		in string
+		m  interface{}
+	}{
+		{"d1:xi1ee", new(map[int]int)},
+		{"d3:300i1ee", new(map[int8]int)},
+		{"d2:-1i1ee", new(map[uint]int)},
+		{"d3:abci1ee", new(map[[4]byte]int)},
+		{"d2:abi1ee", new(map[textKey]int)},
+		{"d1:1i1ee", new(map[float64]int)},
+	} {
+		if err := Unmarshal([]byte(tt.in), tt.m); err == nil {
+			t.Errorf("Unmarshal(%q) into %T: no error", tt.in, tt.m)
+		}
+	}
+	if _, err := Marshal(map[float64]int{1: 1}); err == nil {
+		t.Error("Marshal of a map[float64]int: no error")
+	}
+}
+
+type badUnmarshaler struct{}
+
+var errBad = errors.New("bad value")
+
+func (*badUnmarshaler) UnmarshalBencode([]byte) error { return errBad }
+
+func TestErrorPath(t *testing.T) {
+	var v struct {
+		Info struct {
+			Files []struct {
+				Length int64 `bencode:"length"`
+			} `bencode:"files"`
+		} `bencode:"info"`
+	}
+	in := "d4:infod5:filesld6:lengthi1eed6:length1:xeeee"
+	err := Unmarshal([]byte(in), &v)
+	ute, ok := err.(*UnmarshalTypeError)
+	if !ok || ute.Field != "info.files[1].length" || ute.Offset != 38 {
+		t.Errorf("got %#v", err)
+	}
+	if want := "bencode: cannot unmarshal string into Go value of type int64 at info.files[1].length"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+
+	// Offsets are in the stream.
+	dec := NewDecoder(strings.NewReader("i1e" + in))
+	var i int
+	if err = dec.Decode(&i); err != nil {
+		t.Fatal(err)
+	}
+	if err = dec.Decode(&v); !errors.As(err, &ute) || ute.Offset != 41 {
+		t.Errorf("got %v at %d, want offset 41", err, ute.Offset)
+	}
+
+	var u struct{ A []badUnmarshaler }
+	err = Unmarshal([]byte("d1:Ald1:xi1eeee"), &u)
+	fe, ok := err.(*FieldError)
+	if !ok || fe.Path != "A[0]" || fe.Offset != 5 || !errors.Is(err, errBad) {
+		t.Errorf("got %#v", err)
+	}
+	if want := "bencode: A[0]: bad value"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+
+	var x interface{}
+	err = Unmarshal([]byte("d1:ali1ei99999999999999999999eee"), &x)
+	var ne *strconv.NumError
+	if !errors.As(err, &fe) || fe.Path != "a[1]" || fe.Offset != 8 || !errors.As(err, &ne) {
+		t.Errorf("got %#v", err)
+	}
+
+	// Encoding names Go fields.
+	_, err = Marshal(struct{ A []interface{} }{[]interface{}{1, make(chan int)}})
+	var ste *UnsupportedTypeError
+	if !errors.As(err, &fe) || fe.Path != "A[1]" || fe.Offset != 8 || !errors.As(err, &ste) {
+		t.Errorf("got %#v", err)
+	}
+	if want := "bencode: A[1]: unsupported type: chan int"; err == nil || err.Error() != want {
+		t.Errorf("got %v, want %s", err, want)
+	}
+	_, err = Marshal(map[string]interface{}{"k": []interface{}{func() {}}})
+	if !errors.As(err, &fe) || fe.Path != "k[0]" {
+		t.Errorf("got %#v", err)
+	}
+}
@@ -18,6 +18,14 @@ type scanner struct {
 	// Error that happened, if any.
 	err error
 
+	// Reject input that is not in canonical form.
+	strict bool
+
+	// Limits to enforce, if not nil, and the number of elements
+	// read at each level of parseState.
+	limits *DecoderOptions
+	counts []int
+
 	// storage for string length numeral bytes
 	strLenB []byte
 
@@ -27,9 +35,16 @@ type scanner struct {
 
 // stateBeginValue is the state at the beginning of the input.
 func stateBeginValue(s *scanner, c int) int {
+	if s.limits != nil && s.checkBegin(c) == scanError {
+		return scanError
+	}
 	switch c {
 	case 'i':
-		s.step = stateParseInteger
+		if s.strict {
+			s.step = stateBeginInteger
+		} else {
+			s.step = stateParseInteger
+		}
 		s.pushParseState(parseInteger)
 		return scanBeginInteger
 	case 'l':
@@ -53,22 +68,31 @@ func stateBeginValue(s *scanner, c int) int {
 
 func stateParseStringLen(s *scanner, c int) int {
 	if c == ':' {
-		l, err := strconv.Atoi(string(s.strLenB))
-		if err != nil {
-			s.err = err
+		l := s.strLenBValue()
+		if s.checkStringLen(l) == scanError {
 			return scanError
 		}
 		// decoder should read this string as a slice
 		s.popParseState()
-		// BUG(emery): undefined behavior with top level strings
-
-		// this is a problem, if this string is a top-level object,
-		// the fact that this scanner has reached the end isn't communicated.
-		// I guess I could shift the string length and set scanEnd bits
+		// The caller skips the bytes of the string. If it is
+		// a top-level value, popParseState has set endTop, and
+		// the value ends with the last of those bytes.
 		return l
 	}
 	if c >= '0' && c <= '9' {
+		if s.strict && s.strLenB[0] == '0' {
+			return s.error(c, "after leading zero in string length")
+		}
+		// Check the length on every digit, as generic.go does,
+		// so that errors have the same offsets on every platform.
+		n := s.strLenBValue()
+		if n > (maxInt-9)/10 {
+			return s.error(c, "in string length that is too large")
+		}
 		s.strLenB = append(s.strLenB, byte(c))
+		if s.checkStringLen(n*10+(c-'0')) == scanError {
+			return scanError
+		}
 		return scanParseStringLen
 	}
 	return s.error(c, "in string length")
@@ -83,6 +107,9 @@ func stateBeginDictKey(s *scanner, c int) int {
 		return scanEndDict
 	}
 	if c >= '0' && c <= '9' {
+		if s.limits != nil && s.countElement() == scanError {
+			return scanError
+		}
 		s.strLenB = append(s.strLenB[0:0], byte(c))
 		s.step = stateParseKeyLen
 		return scanBeginKeyLen
@@ -92,9 +119,8 @@ func stateBeginDictKey(s *scanner, c int) int {
 
 func stateParseKeyLen(s *scanner, c int) int {
 	if c == ':' {
-		l, err := strconv.Atoi(string(s.strLenB))
-		if err != nil {
-			s.err = err
+		l := s.strLenBValue()
+		if s.checkStringLen(l) == scanError {
 			return scanError
 		}
 		// decoder should read this chunk at once
@@ -102,8 +128,27 @@ func stateParseKeyLen(s *scanner, c int) int {
 		return l
 	}
 	if c >= '0' && c <= '9' {
+		if s.strict && s.strLenB[0] == '0' {
+			return s.error(c, "after leading zero in dictionary key length")
+		}
+		// Check the length on every digit, as generic.go does,
+		// so that errors have the same offsets on every platform.
+		n := s.strLenBValue()
+		if n > (maxInt-9)/10 {
+			return s.error(c, "in dictionary key length that is too large")
+		}
 		s.strLenB = append(s.strLenB, byte(c))
+		if s.checkStringLen(n*10+(c-'0')) == scanError {
+			return scanError
+		}
 		return scanParseKeyLen
 	}
 	return s.error(c, "in dictionary key length")
 }
+
+// strLenBValue returns the length read into s.strLenB,
+// which the checks on each digit keep within an int.
+func (s *scanner) strLenBValue() int {
+	n, _ := strconv.Atoi(string(s.strLenB))
+	return n
+}
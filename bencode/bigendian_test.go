@@ -0,0 +1,27 @@
+// +build !386,!amd64
+
+package bencode
+
+import "testing"
+
+func TestScannerTopLevelString(t *testing.T) {
+	var s scanner
+	s.reset()
+	for i, c := range []byte("1000") {
+		if op := s.step(&s, int(c)); op >= 0 || s.endTop {
+			t.Fatalf("byte %d: op %d, endTop %v", i, op, s.endTop)
+		}
+	}
+	if string(s.strLenB) != "1000" {
+		t.Errorf("strLenB %q", s.strLenB)
+	}
+	if op := s.step(&s, ':'); op != 1000 || !s.endTop {
+		t.Errorf("':': op %d, endTop %v", op, s.endTop)
+	}
+
+	s.reset()
+	s.step(&s, '0')
+	if op := s.step(&s, ':'); op != 0 || !s.endTop {
+		t.Errorf("empty string: op %d, endTop %v", op, s.endTop)
+	}
+}
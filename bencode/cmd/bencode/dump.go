@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func dumpCmd(args []string, stdout io.Writer) error {
+	fs := newFlagSet("dump")
+	fs.Parse(args)
+	for _, name := range fileArgs(fs.Args()) {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		if err = dump(stdout, data); err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// dump writes the tokens of the values in data to w.
+func dump(w io.Writer, data []byte) error {
+	dec := bencode.NewDecoder(bytes.NewReader(data))
+
+	// inDict records at each depth whether the
+	// container is a dictionary, and key whether
+	// the next token is a dictionary key.
+	var inDict []bool
+	var key bool
+	var prefix string
+	var keyOffset int64
+	for {
+		off := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if key {
+			if tok != bencode.End {
+				prefix = formatString(tok.(bencode.String)) + ": "
+				keyOffset = off
+				key = false
+				continue
+			}
+		} else if prefix != "" {
+			off = keyOffset
+		}
+
+		depth := len(inDict)
+		var s string
+		switch tok := tok.(type) {
+		case bencode.Int:
+			s = strconv.FormatInt(int64(tok), 10)
+		case bencode.Number:
+			s = string(tok)
+		case bencode.String:
+			s = formatString(tok)
+		case bencode.Delim:
+			s = tok.String()
+			switch tok {
+			case bencode.ListStart:
+				inDict = append(inDict, false)
+			case bencode.DictStart:
+				inDict = append(inDict, true)
+			case bencode.End:
+				inDict = inDict[:len(inDict)-1]
+				depth--
+			}
+		}
+		fmt.Fprintf(w, "%8d  %s%s%s\n", off, strings.Repeat("  ", depth), prefix, s)
+		prefix = ""
+		key = len(inDict) > 0 && inDict[len(inDict)-1]
+	}
+}
+
+// maxDumpString is the number of bytes of a string shown by dump.
+const maxDumpString = 64
+
+// formatString quotes s if it is UTF-8 and formats it in
+// hexadecimal otherwise, shortening it if it is long.
+func formatString(s []byte) string {
+	n := len(s)
+	text := utf8.Valid(s)
+	if n > maxDumpString {
+		s = s[:maxDumpString]
+	}
+	var f string
+	if text {
+		f = strconv.Quote(strings.ToValidUTF8(string(s), ""))
+	} else {
+		f = "<" + hex.EncodeToString(s) + ">"
+	}
+	if n > len(s) {
+		f += fmt.Sprintf("... (%d bytes)", n)
+	}
+	return f
+}
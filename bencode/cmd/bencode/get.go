@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func getCmd(args []string, stdout io.Writer) error {
+	fs := newFlagSet("get")
+	raw := fs.Bool("raw", false, "print the bencoding of the value")
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		return errors.New("get: no file")
+	}
+	data, err := readFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	v, err := get(data, fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	if *raw {
+		_, err = stdout.Write(v)
+		return err
+	}
+	switch {
+	case v[0] == 'i':
+		_, err = fmt.Fprintf(stdout, "%s\n", v[1:len(v)-1])
+	case v[0] == 'l' || v[0] == 'd':
+		err = dump(stdout, v)
+	default:
+		var s []byte
+		if err = bencode.Unmarshal(v, &s); err != nil {
+			return err
+		}
+		if utf8.Valid(s) {
+			_, err = fmt.Fprintf(stdout, "%s\n", s)
+		} else {
+			_, err = fmt.Fprintf(stdout, "%s\n", hex.EncodeToString(s))
+		}
+	}
+	return err
+}
+
+// get returns the value at path in data. Elements of path that
+// are integers are indexes if they apply to a list.
+func get(data []byte, args []string) (bencode.RawMessage, error) {
+	v := bencode.Lookup(data)
+	if v == nil {
+		return nil, bencode.Valid(data)
+	}
+	for n, arg := range args {
+		var elem interface{} = arg
+		if v[0] == 'l' {
+			i, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, fmt.Errorf("get: %q is not a list index", arg)
+			}
+			elem = i
+		}
+		if v = bencode.Lookup(v, elem); v == nil {
+			return nil, fmt.Errorf("get: no value at %s", strings.Join(args[:n+1], "/"))
+		}
+	}
+	return v, nil
+}
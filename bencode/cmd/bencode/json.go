@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func toJSONCmd(args []string, stdout io.Writer) error {
+	fs := newFlagSet("tojson")
+	binary := fs.String("binary", "hex", "encoding of binary strings, hex or base64")
+	indent := fs.Bool("indent", false, "indent the output")
+	fs.Parse(args)
+	if *binary != "hex" && *binary != "base64" {
+		return fmt.Errorf("tojson: unknown binary encoding %q", *binary)
+	}
+	if fs.NArg() > 1 {
+		return errors.New("tojson: more than one file")
+	}
+	data, err := readFile(fileArgs(fs.Args())[0])
+	if err != nil {
+		return err
+	}
+	v, err := bencode.Parse(data)
+	if err != nil {
+		return err
+	}
+	b, err := toJSON(nil, v, *binary)
+	if err != nil {
+		return err
+	}
+	if *indent {
+		var buf bytes.Buffer
+		json.Indent(&buf, b, "", "\t")
+		b = buf.Bytes()
+	}
+	_, err = stdout.Write(append(b, '\n'))
+	return err
+}
+
+// toJSON appends the JSON form of v to b, with binary strings
+// in objects keyed by "$hex" or "$base64", following binary.
+// So that a dictionary is not taken for one of those objects,
+// the key of a dictionary with a single key that starts with
+// "$" is written with another "$" in front.
+func toJSON(b []byte, v *bencode.Value, binary string) ([]byte, error) {
+	switch v.Kind() {
+	case bencode.KindInt:
+		n := v.Number()
+		if i, err := n.Int64(); err == nil {
+			return strconv.AppendInt(b, i, 10), nil
+		}
+		// Too large for an int64; BigInt drops any leading zeros.
+		z, err := n.BigInt()
+		if err != nil {
+			return nil, err
+		}
+		return append(b, z.String()...), nil
+
+	case bencode.KindBytes:
+		s := v.Bytes()
+		if utf8.Valid(s) {
+			return appendJSONString(b, string(s)), nil
+		}
+		b = append(b, `{"$`...)
+		b = append(b, binary...)
+		b = append(b, `":"`...)
+		if binary == "hex" {
+			b = append(b, hex.EncodeToString(s)...)
+		} else {
+			b = append(b, base64.StdEncoding.EncodeToString(s)...)
+		}
+		return append(b, `"}`...), nil
+
+	case bencode.KindList:
+		b = append(b, '[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			var err error
+			if b, err = toJSON(b, v.Index(i), binary); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, ']'), nil
+
+	case bencode.KindDict:
+		b = append(b, '{')
+		keys := v.Keys()
+		for i, key := range keys {
+			if !utf8.ValidString(key) {
+				return nil, fmt.Errorf("tojson: dictionary key %q is not UTF-8", key)
+			}
+			if i > 0 {
+				b = append(b, ',')
+			}
+			if len(keys) == 1 && strings.HasPrefix(key, "$") {
+				b = appendJSONString(b, "$"+key)
+			} else {
+				b = appendJSONString(b, key)
+			}
+			b = append(b, ':')
+			var err error
+			if b, err = toJSON(b, v.Get(key), binary); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, '}'), nil
+	}
+	return nil, errors.New("tojson: invalid value")
+}
+
+func appendJSONString(b []byte, s string) []byte {
+	j, _ := json.Marshal(s)
+	return append(b, j...)
+}
+
+func fromJSONCmd(args []string, stdout io.Writer) error {
+	fs := newFlagSet("fromjson")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		return errors.New("fromjson: more than one file")
+	}
+	data, err := readFile(fileArgs(fs.Args())[0])
+	if err != nil {
+		return err
+	}
+	b, err := fromJSON(data)
+	if err != nil {
+		return err
+	}
+	_, err = stdout.Write(b)
+	return err
+}
+
+// fromJSON returns the bencoding of the JSON value in data,
+// as produced by toJSON.
+func fromJSON(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return nil, err
+	}
+	x, err := fromJSONValue(x)
+	if err != nil {
+		return nil, err
+	}
+	return bencode.Marshal(x)
+}
+
+// fromJSONValue converts a decoded JSON value to one
+// that Marshal encodes as the value it represents.
+func fromJSONValue(x interface{}) (interface{}, error) {
+	switch x := x.(type) {
+	case json.Number:
+		// Integers of any size are kept in decimal form.
+		if _, err := bencode.Number(x).BigInt(); err != nil {
+			return nil, fmt.Errorf("fromjson: %s is not an integer", x)
+		}
+		return bencode.Number(x), nil
+
+	case string:
+		return x, nil
+
+	case []interface{}:
+		for i, elem := range x {
+			var err error
+			if x[i], err = fromJSONValue(elem); err != nil {
+				return nil, err
+			}
+		}
+		return x, nil
+
+	case map[string]interface{}:
+		if len(x) == 1 {
+			for k, v := range x {
+				s, ok := v.(string)
+				switch {
+				case k == "$hex" && ok:
+					return hex.DecodeString(s)
+				case k == "$base64" && ok:
+					return base64.StdEncoding.DecodeString(s)
+				case strings.HasPrefix(k, "$$"):
+					// A dictionary key escaped by toJSON.
+					delete(x, k)
+					k = k[1:]
+					var err error
+					if x[k], err = fromJSONValue(v); err != nil {
+						return nil, err
+					}
+					return x, nil
+				}
+			}
+		}
+		for k, v := range x {
+			var err error
+			if x[k], err = fromJSONValue(v); err != nil {
+				return nil, err
+			}
+		}
+		return x, nil
+	}
+	return nil, fmt.Errorf("fromjson: bencode has no %v", x)
+}
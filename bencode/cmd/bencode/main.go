@@ -0,0 +1,98 @@
+// bencode is a utility for inspecting and converting bencoded data,
+// such as .torrent files and DHT packets.
+//
+// Usage:
+//
+//	bencode dump [file ...]
+//	bencode tojson [-binary hex|base64] [-indent] [file]
+//	bencode fromjson [file]
+//	bencode validate [file ...]
+//	bencode get [-raw] file path ...
+//
+// Files default to the standard input, which may also be named "-".
+//
+// dump prints the tokens of each value, one per line, indented by
+// depth and preceded by their byte offset in the input.
+//
+// tojson converts a value to JSON. Integers become numbers and strings
+// that are valid UTF-8 become strings. Other strings become an object
+// with the single key "$hex" or "$base64", holding the string in that
+// encoding. fromjson reverses the conversion, writing dictionary keys
+// in canonical order.
+//
+// validate checks that each file holds a single value in the
+// canonical form of BEP 3.
+//
+// get prints the value at path, where each element of the path is a
+// dictionary key, or, within a list, an index. Integers and UTF-8
+// strings are printed as text, binary strings in hexadecimal, and
+// lists and dictionaries as by dump.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+var commands = map[string]func(args []string, stdout io.Writer) error{
+	"dump":     dumpCmd,
+	"tojson":   toJSONCmd,
+	"fromjson": fromJSONCmd,
+	"validate": validateCmd,
+	"get":      getCmd,
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, `usage: bencode <command> [arguments]
+
+commands:
+	dump [file ...]                      print the tokens of values with their offsets
+	tojson [-binary hex|base64] [-indent] [file]
+	                                     convert a value to JSON
+	fromjson [file]                      convert JSON to a canonical value
+	validate [file ...]                  check that values are canonical
+	get [-raw] file path ...             print the value at path`)
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "bencode: unknown command %q\n", os.Args[1])
+		usage()
+	}
+	if err := cmd(os.Args[2:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns a FlagSet for the named command
+// that exits on errors.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("bencode "+name, flag.ExitOnError)
+}
+
+// readFile returns the contents of the named file,
+// or of the standard input if name is "-".
+func readFile(name string) ([]byte, error) {
+	if name == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// fileArgs returns the file arguments of a command,
+// which default to the standard input.
+func fileArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{"-"}
+	}
+	return args
+}
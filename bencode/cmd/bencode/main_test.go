@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+var torrent = []byte("d8:announce3:url4:infod5:filesld6:lengthi1e4:pathl1:aeee4:name1:f6:pieces4:\x00\x01\xff\x03ee")
+
+func TestJSON(t *testing.T) {
+	v, err := bencode.Parse(torrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for binary, want := range map[string]string{
+		"hex":    `{"announce":"url","info":{"files":[{"length":1,"path":["a"]}],"name":"f","pieces":{"$hex":"0001ff03"}}}`,
+		"base64": `{"announce":"url","info":{"files":[{"length":1,"path":["a"]}],"name":"f","pieces":{"$base64":"AAH/Aw=="}}}`,
+	} {
+		j, err := toJSON(nil, v, binary)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(j) != want {
+			t.Errorf("toJSON %s: got %s, want %s", binary, j, want)
+		}
+		b, err := fromJSON(j)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, torrent) {
+			t.Errorf("fromJSON %s: got %q", binary, b)
+		}
+	}
+
+	// Dictionaries that look like binary strings,
+	// and integers too large for an int64.
+	for _, tt := range []struct{ in, json, out string }{
+		{"d4:$hex4:abcde", `{"$$hex":"abcd"}`, ""},
+		{"d7:$base641:xe", `{"$$base64":"x"}`, ""},
+		{"d5:$$hex1:xe", `{"$$$hex":"x"}`, ""},
+		{"d4:$hex1:x1:ai1ee", `{"$hex":"x","a":1}`, ""},
+		{"li99999999999999999999ei-99999999999999999999ei03ee", `[99999999999999999999,-99999999999999999999,3]`, "li99999999999999999999ei-99999999999999999999ei3ee"},
+	} {
+		v, err := bencode.Parse([]byte(tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		j, err := toJSON(nil, v, "hex")
+		if err != nil || string(j) != tt.json {
+			t.Errorf("toJSON(%q): got %s, %v, want %s", tt.in, j, err, tt.json)
+			continue
+		}
+		want := tt.out
+		if want == "" {
+			want = tt.in
+		}
+		if b, err := fromJSON(j); err != nil || string(b) != want {
+			t.Errorf("fromJSON(%s): got %q, %v, want %q", j, b, err, want)
+		}
+	}
+
+	for _, in := range []string{`1.5`, `1e3`, `true`, `null`, `{"a":[null]}`} {
+		if b, err := fromJSON([]byte(in)); err == nil {
+			t.Errorf("fromJSON(%s): got %q, want error", in, b)
+		}
+	}
+}
+
+func TestDump(t *testing.T) {
+	var buf bytes.Buffer
+	if err := dump(&buf, []byte("d1:ali1eeed1:b0:e")); err != nil {
+		t.Fatal(err)
+	}
+	want := `       0  DictStart
+       1    "a": ListStart
+       5      1
+       8    End
+       9  End
+      10  DictStart
+      11    "b": ""
+      16  End
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", &buf, want)
+	}
+	if err := dump(&buf, []byte("d1:a")); err == nil {
+		t.Error("truncated input dumped")
+	}
+
+	// An integer too large for an int64.
+	buf.Reset()
+	if err := dump(&buf, []byte("li99999999999999999999ee")); err != nil {
+		t.Fatal(err)
+	}
+	want = `       0  ListStart
+       1    99999999999999999999
+      23  End
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", &buf, want)
+	}
+}
+
+func TestGet(t *testing.T) {
+	for _, tt := range []struct {
+		path []string
+		want string
+	}{
+		{[]string{"info", "files", "0", "length"}, "i1e"},
+		{[]string{"info", "name"}, "1:f"},
+		{[]string{"info", "files", "1"}, ""},
+		{[]string{"info", "files", "x"}, ""},
+		{[]string{"announce", "x"}, ""},
+	} {
+		v, err := get(torrent, tt.path)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("get %v: got %q, want error", tt.path, v)
+			}
+		} else if string(v) != tt.want {
+			t.Errorf("get %v: got %q, %v, want %q", tt.path, v, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func validateCmd(args []string, stdout io.Writer) error {
+	fs := newFlagSet("validate")
+	fs.Parse(args)
+	var failed bool
+	for _, name := range fileArgs(fs.Args()) {
+		data, err := readFile(name)
+		if err != nil {
+			return err
+		}
+		if err = bencode.ValidCanonical(data); err != nil {
+			if se, ok := err.(*bencode.SyntaxError); ok {
+				fmt.Fprintf(stdout, "%s: offset %d: %s\n", name, se.Offset, se)
+			} else {
+				fmt.Fprintf(stdout, "%s: %s\n", name, err)
+			}
+			failed = true
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: ok\n", name)
+	}
+	if failed {
+		return errors.New("validate: invalid input")
+	}
+	return nil
+}
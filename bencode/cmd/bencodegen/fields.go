@@ -0,0 +1,256 @@
+package main
+
+import (
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// This file follows typeFields of the bencode package,
+// working on go/types rather than reflect.
+
+// A field represents a single field found in a struct.
+type field struct {
+	name      string
+	tag       bool
+	index     []int
+	typ       types.Type
+	omitEmpty bool
+	rest      bool // collects unknown keys; see splitRest
+	quoted    bool // number encoded as a decimal string
+	unixMilli bool // time encoded in milliseconds
+
+	// path holds the fields leading to and including this one.
+	path []*types.Var
+}
+
+// byName sorts field by name, breaking ties with depth,
+// then breaking ties with "name came from bencode tag", then
+// breaking ties with index sequence.
+type byName []field
+
+func (x byName) Len() int { return len(x) }
+
+func (x byName) Swap(i, j int) { x[i], x[j] = x[j], x[i] }
+
+func (x byName) Less(i, j int) bool {
+	if x[i].name != x[j].name {
+		return x[i].name < x[j].name
+	}
+	if len(x[i].index) != len(x[j].index) {
+		return len(x[i].index) < len(x[j].index)
+	}
+	if x[i].tag != x[j].tag {
+		return x[i].tag
+	}
+	for k, xik := range x[i].index {
+		if k >= len(x[j].index) {
+			return false
+		}
+		if xik != x[j].index[k] {
+			return xik < x[j].index[k]
+		}
+	}
+	return len(x[i].index) < len(x[j].index)
+}
+
+func isValidTag(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:<=>?@[]^_{|}~ ", c):
+		default:
+			if !unicode.IsLetter(c) && !unicode.IsDigit(c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseTag splits a bencode tag into its name and options.
+func parseTag(tag string) (string, []string) {
+	if i := strings.Index(tag, ","); i != -1 {
+		return tag[:i], strings.Split(tag[i+1:], ",")
+	}
+	return tag, nil
+}
+
+// restType is the type of a field with the "rest" option.
+const restType = "map[string]github.com/ehmry/encoding/bencode.RawMessage"
+
+// splitRest returns the fields of a struct without the field
+// with the "rest" option, which typeFields puts last, and that
+// field, or nil if there is none.
+func splitRest(fields []field) ([]field, *field) {
+	if n := len(fields); n > 0 && fields[n-1].rest {
+		return fields[:n-1], &fields[n-1]
+	}
+	return fields, nil
+}
+
+// isNumber reports whether the "string" option applies to t.
+func isNumber(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&(types.IsInteger|types.IsFloat) != 0
+}
+
+func contains(opts []string, name string) bool {
+	for _, o := range opts {
+		if o == name {
+			return true
+		}
+	}
+	return false
+}
+
+// typeFields returns the fields that bencode recognizes for
+// the struct type t, in the order they are encoded.
+func typeFields(t types.Type) []field {
+	current := []field{}
+	next := []field{{typ: t}}
+
+	count := map[string]int{}
+	nextCount := map[string]int{}
+	visited := map[string]bool{}
+
+	var fields []field
+	var rest *field
+
+	for len(next) > 0 {
+		current, next = next, current[:0]
+		count, nextCount = nextCount, map[string]int{}
+
+		for _, f := range current {
+			key := types.TypeString(f.typ, nil)
+			if visited[key] {
+				continue
+			}
+			visited[key] = true
+
+			st := f.typ.Underlying().(*types.Struct)
+			for i := 0; i < st.NumFields(); i++ {
+				sf := st.Field(i)
+				if sf.Anonymous() {
+					t := sf.Type()
+					if p, ok := t.(*types.Pointer); ok {
+						t = p.Elem()
+					}
+					// The exported fields of an embedded struct
+					// of an unexported type are promoted as well.
+					if _, ok := t.Underlying().(*types.Struct); !sf.Exported() && !ok {
+						continue
+					}
+				} else if !sf.Exported() {
+					continue
+				}
+				tag := reflect.StructTag(st.Tag(i)).Get("bencode")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				if !isValidTag(name) {
+					name = ""
+				}
+				index := append(f.index[:len(f.index):len(f.index)], i)
+				path := append(f.path[:len(f.path):len(f.path)], sf)
+
+				if contains(opts, "rest") && types.TypeString(sf.Type(), nil) == restType {
+					if rest == nil {
+						rest = &field{name: sf.Name(), index: index, typ: sf.Type(), rest: true, path: path}
+					}
+					continue
+				}
+
+				ft := sf.Type()
+				if _, ok := ft.(*types.Named); !ok {
+					if p, ok := ft.(*types.Pointer); ok {
+						ft = p.Elem()
+					}
+				}
+				_, isStruct := ft.Underlying().(*types.Struct)
+
+				if name != "" || !sf.Anonymous() || !isStruct {
+					tagged := name != ""
+					if name == "" {
+						name = sf.Name()
+					}
+					fields = append(fields, field{
+						name:      name,
+						tag:       tagged,
+						index:     index,
+						typ:       ft,
+						omitEmpty: contains(opts, "omitempty"),
+						quoted:    contains(opts, "string") && isNumber(ft),
+						unixMilli: contains(opts, "unixms") && types.TypeString(ft, nil) == "time.Time",
+						path:      path,
+					})
+					if count[key] > 1 {
+						fields = append(fields, fields[len(fields)-1])
+					}
+					continue
+				}
+
+				ftKey := types.TypeString(ft, nil)
+				nextCount[ftKey]++
+				if nextCount[ftKey] == 1 {
+					next = append(next, field{index: index, typ: ft, path: path})
+				}
+			}
+		}
+	}
+
+	sort.Sort(byName(fields))
+
+	out := fields[:0]
+	for advance, i := 0, 0; i < len(fields); i += advance {
+		fi := fields[i]
+		name := fi.name
+		for advance = 1; i+advance < len(fields); advance++ {
+			if fields[i+advance].name != name {
+				break
+			}
+		}
+		if advance == 1 {
+			out = append(out, fi)
+			continue
+		}
+		if dominant, ok := dominantField(fields[i : i+advance]); ok {
+			out = append(out, dominant)
+		}
+	}
+	if rest != nil {
+		out = append(out, *rest)
+	}
+	return out
+}
+
+// dominantField returns the field that dominates the others,
+// which all have the same name, or false if there is none.
+func dominantField(fields []field) (field, bool) {
+	length := len(fields[0].index)
+	tagged := -1
+	for i, f := range fields {
+		if len(f.index) > length {
+			fields = fields[:i]
+			break
+		}
+		if f.tag {
+			if tagged >= 0 {
+				return field{}, false
+			}
+			tagged = i
+		}
+	}
+	if tagged >= 0 {
+		return fields[tagged], true
+	}
+	if len(fields) > 1 {
+		return field{}, false
+	}
+	return fields[0], true
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// How a type is encoded and decoded by generated code.
+const (
+	kindOther  = iota // passed to Marshal and UnmarshalField
+	kindString        // string kind
+	kindBytes         // []byte
+	kindInt           // signed integer kind
+	kindUint          // unsigned integer kind
+	kindStruct        // a type being generated
+	kindPtr           // pointer to a type being generated
+	kindSlice         // slice of a kind above other than kindOther
+)
+
+// A generator writes the methods of a package's types.
+type generator struct {
+	pkg     *types.Package
+	types   map[*types.Named]bool
+	imports map[string]string // path to name
+	w       *bytes.Buffer
+
+	// needErr is set when the function being written uses err.
+	needErr bool
+}
+
+// generate returns the source of the methods of the named
+// types of pkg. args are the arguments bencodegen was run with.
+func generate(pkg *types.Package, names []string, args string) ([]byte, error) {
+	g := &generator{
+		pkg:     pkg,
+		types:   make(map[*types.Named]bool),
+		imports: map[string]string{"github.com/ehmry/encoding/bencode": "bencode", "reflect": "reflect"},
+		w:       new(bytes.Buffer),
+	}
+	var named []*types.Named
+	for _, name := range names {
+		obj := pkg.Scope().Lookup(name)
+		if obj == nil {
+			return nil, fmt.Errorf("type %s not found in package %s", name, pkg.Name())
+		}
+		t, ok := obj.Type().(*types.Named)
+		if _, isStruct := obj.Type().Underlying().(*types.Struct); !ok || !isStruct {
+			return nil, fmt.Errorf("%s is not a struct type", name)
+		}
+		for _, f := range typeFields(t) {
+			if _, ok := f.path[len(f.path)-1].Type().(*types.Pointer); ok && (f.quoted || f.unixMilli) {
+				return nil, fmt.Errorf("%s.%s: options string and unixms are not supported on pointers", name, f.path[len(f.path)-1].Name())
+			}
+		}
+		g.types[t] = true
+		named = append(named, t)
+	}
+	for _, t := range named {
+		g.marshal(t)
+		g.unmarshal(t)
+	}
+
+	var src bytes.Buffer
+	fmt.Fprintf(&src, "// Code generated by \"bencodegen %s\"; DO NOT EDIT.\n\n", args)
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", pkg.Name())
+	// Standard packages come first, as goimports has them.
+	var std, other []string
+	for path := range g.imports {
+		if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+			other = append(other, path)
+		} else {
+			std = append(std, path)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	for _, path := range std {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	if len(std) > 0 && len(other) > 0 {
+		src.WriteString("\n")
+	}
+	for _, path := range other {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	src.WriteString(")\n")
+	src.Write(g.w.Bytes())
+	return format.Source(src.Bytes())
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.w, format, args...)
+}
+
+// typeString returns the Go source of t in the generated file.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+// hasMethod reports whether the method set of t
+// or of a pointer to t has the named method.
+func hasMethod(t types.Type, name string) bool {
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	return types.NewMethodSet(t).Lookup(nil, name) != nil
+}
+
+// isByteSlice reports whether t is []byte.
+func isByteSlice(t types.Type) bool {
+	s, ok := t.(*types.Slice)
+	return ok && types.Identical(s.Elem(), types.Typ[types.Uint8])
+}
+
+// kind returns how t is handled by generated code.
+func (g *generator) kind(t types.Type) int {
+	if n, ok := t.(*types.Named); ok && g.types[n] {
+		return kindStruct
+	}
+	if p, ok := t.(*types.Pointer); ok {
+		if n, ok := p.Elem().(*types.Named); ok && g.types[n] {
+			return kindPtr
+		}
+		return kindOther
+	}
+	for _, m := range []string{"MarshalBencode", "UnmarshalBencode", "MarshalText", "UnmarshalText"} {
+		if hasMethod(t, m) {
+			return kindOther
+		}
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch i := u.Info(); {
+		case i&types.IsString != 0:
+			return kindString
+		case i&types.IsInteger != 0 && i&types.IsUnsigned != 0:
+			return kindUint
+		case i&types.IsInteger != 0:
+			return kindInt
+		}
+	case *types.Slice:
+		if isByteSlice(u) {
+			return kindBytes
+		}
+		if g.kind(u.Elem()) != kindOther {
+			return kindSlice
+		}
+	}
+	return kindOther
+}
+
+// nonEmptyTest returns the expression that is true if x of type t
+// is not empty for omitempty, or "" if x is never empty.
+func nonEmptyTest(x string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch i := u.Info(); {
+		case i&types.IsString != 0:
+			return x + ` != ""`
+		case i&types.IsBoolean != 0:
+			return x
+		case i&(types.IsInteger|types.IsFloat) != 0:
+			return x + " != 0"
+		}
+	case *types.Array, *types.Slice, *types.Map:
+		return "len(" + x + ") != 0"
+	case *types.Pointer, *types.Interface:
+		return x + " != nil"
+	case *types.Struct:
+		if types.TypeString(t, nil) == "time.Time" {
+			return "!" + x + ".IsZero()"
+		}
+	}
+	return ""
+}
+
+// fieldExpr returns the expression of f in v, and the
+// embedded pointers on the way to f.
+func fieldExpr(f field) (string, []string) {
+	x := "v"
+	var ptrs []string
+	for i, sf := range f.path {
+		x += "." + sf.Name()
+		if _, ok := sf.Type().(*types.Pointer); ok && i < len(f.path)-1 {
+			ptrs = append(ptrs, x)
+		}
+	}
+	return x, ptrs
+}
+
+// marshal writes the MarshalBencode method of t.
+func (g *generator) marshal(t *types.Named) {
+	name := t.Obj().Name()
+	body, saved := new(bytes.Buffer), g.w
+	g.w = body
+	g.needErr = false
+	fields, rest := splitRest(typeFields(t))
+	var xr string
+	if rest != nil {
+		// Merge the keys of the rest field, other than
+		// those of the fields, in with the fields.
+		var ptrs []string
+		xr, ptrs = fieldExpr(*rest)
+		g.needErr = true
+		g.printf("var rest []string\n")
+		var cond []string
+		for _, p := range append(ptrs, xr) {
+			cond = append(cond, p+" != nil")
+		}
+		g.printf("if %s {\n", strings.Join(cond, " && "))
+		g.printf("rest = bencode.RestKeys(%s, bencodeKeys%s)\n}\n", xr, name)
+	}
+	for _, f := range fields {
+		if rest != nil {
+			g.printf("for ; len(rest) > 0 && rest[0] < %q; rest = rest[1:] {\n", f.name)
+			g.appendEntry("rest[0]", xr)
+			g.printf("}\n")
+		}
+		x, ptrs := fieldExpr(f)
+		var cond []string
+		for _, p := range ptrs {
+			cond = append(cond, p+" != nil")
+		}
+		if f.omitEmpty {
+			if e := nonEmptyTest(x, f.path[len(f.path)-1].Type()); e != "" {
+				cond = append(cond, e)
+			}
+		}
+		if len(cond) > 0 {
+			g.printf("if %s {\n", strings.Join(cond, " && "))
+		}
+		key := strconv.Itoa(len(f.name)) + ":" + f.name
+		g.printf("b = append(b, %s...)\n", strconv.Quote(key))
+		switch ft := f.path[len(f.path)-1].Type(); {
+		case f.quoted:
+			g.encodeQuoted(x, ft)
+		case f.unixMilli:
+			g.printf("b = bencode.AppendInt(b, %s.Unix()*1000+int64(%s.Nanosecond()/1e6))\n", x, x)
+		default:
+			g.encode(x, ft, 0)
+		}
+		if len(cond) > 0 {
+			g.printf("}\n")
+		}
+	}
+	if rest != nil {
+		g.printf("for _, k := range rest {\n")
+		g.appendEntry("k", xr)
+		g.printf("}\n")
+	}
+	g.w = saved
+
+	g.printf("\n// MarshalBencode implements bencode.Marshaler.\n")
+	g.printf("func (v %s) MarshalBencode() ([]byte, error) {\n", name)
+	g.printf("return v.appendBencode(nil)\n}\n\n")
+	g.printf("func (v %s) appendBencode(b []byte) ([]byte, error) {\n", name)
+	if g.needErr {
+		g.printf("var err error\n")
+	}
+	g.printf("b = append(b, 'd')\n")
+	g.w.Write(body.Bytes())
+	g.printf("return append(b, 'e'), nil\n}\n")
+}
+
+// appendEntry writes the code that appends the entry
+// of the rest field m with the key k to b.
+func (g *generator) appendEntry(k, m string) {
+	g.printf("b = bencode.AppendString(b, %s)\n", k)
+	g.printf("if b, err = bencode.AppendMarshal(b, %s[%s]); err != nil {\nreturn nil, err\n}\n", m, k)
+}
+
+// encodeQuoted writes the code that appends the number x
+// of type t to b as a decimal string.
+func (g *generator) encodeQuoted(x string, t types.Type) {
+	g.imports["strconv"] = "strconv"
+	switch i := t.Underlying().(*types.Basic).Info(); {
+	case i&types.IsFloat != 0:
+		g.printf("b = bencode.AppendString(b, strconv.FormatFloat(float64(%s), 'g', -1, %d))\n", x, basicBits(t))
+	case i&types.IsUnsigned != 0:
+		g.printf("b = bencode.AppendString(b, strconv.FormatUint(uint64(%s), 10))\n", x)
+	default:
+		g.printf("b = bencode.AppendString(b, strconv.FormatInt(int64(%s), 10))\n", x)
+	}
+}
+
+// basicBits returns the size in bits of the number type t,
+// or 0 for the types of the size of an int.
+func basicBits(t types.Type) int {
+	switch t.Underlying().(*types.Basic).Kind() {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int64, types.Uint64, types.Float64:
+		return 64
+	}
+	return 0
+}
+
+// encode writes the code that appends the encoding of x of type t to b.
+func (g *generator) encode(x string, t types.Type, depth int) {
+	switch g.kind(t) {
+	case kindString:
+		if !types.Identical(t, types.Typ[types.String]) {
+			x = "string(" + x + ")"
+		}
+		g.printf("b = bencode.AppendString(b, %s)\n", x)
+	case kindBytes:
+		g.printf("b = bencode.AppendBytes(b, %s)\n", x)
+	case kindInt:
+		g.printf("b = bencode.AppendInt(b, int64(%s))\n", x)
+	case kindUint:
+		g.printf("b = bencode.AppendUint(b, uint64(%s))\n", x)
+	case kindStruct:
+		g.needErr = true
+		g.printf("if b, err = %s.appendBencode(b); err != nil {\nreturn nil, err\n}\n", x)
+	case kindPtr:
+		g.needErr = true
+		g.printf("if %s == nil {\nb = append(b, \"0:\"...)\n", x)
+		g.printf("} else if b, err = %s.appendBencode(b); err != nil {\nreturn nil, err\n}\n", x)
+	case kindSlice:
+		e := fmt.Sprintf("e%d", depth)
+		g.printf("b = append(b, 'l')\nfor _, %s := range %s {\n", e, x)
+		g.encode(e, t.Underlying().(*types.Slice).Elem(), depth+1)
+		g.printf("}\nb = append(b, 'e')\n")
+	default:
+		g.needErr = true
+		g.printf("if b, err = bencode.AppendMarshal(b, %s); err != nil {\nreturn nil, err\n}\n", x)
+	}
+}
+
+// unmarshal writes the UnmarshalBencode method of t.
+func (g *generator) unmarshal(t *types.Named) {
+	name := t.Obj().Name()
+	fields, rest := splitRest(typeFields(t))
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = strconv.Quote(f.name)
+	}
+	g.printf("\nvar bencodeKeys%s = []string{%s}\n", name, strings.Join(keys, ", "))
+
+	g.printf("\n// UnmarshalBencode implements bencode.Unmarshaler.\n")
+	g.printf("func (v *%s) UnmarshalBencode(b []byte) error {\n", name)
+	g.printf("if len(b) == 0 || b[0] != 'd' {\n")
+	g.printf("return bencode.NewUnmarshalTypeError(b, reflect.TypeOf(v).Elem())\n}\n")
+	g.printf("return bencode.ForEachEntry(b, func(key, value []byte) error {\n")
+	g.printf("switch bencode.MatchKey(key, bencodeKeys%s) {\n", name)
+	for i, f := range fields {
+		g.printf("case %d:\n", i)
+		x, ptrs := fieldExpr(f)
+		g.allocPtrs(ptrs, f)
+		switch ft := f.path[len(f.path)-1].Type(); {
+		case f.quoted:
+			g.decodeQuoted(x, ft)
+		case f.unixMilli:
+			g.imports["time"] = "time"
+			g.printf("if value[0] == 'i' {\n")
+			g.printf("n, err := bencode.ParseInt(value)\nif err != nil {\nreturn err\n}\n")
+			g.printf("%s = time.Unix(n/1000, n%%1000*1e6)\n", x)
+			g.printf("} else ")
+			g.printf("if err := bencode.UnmarshalField(value, &%s); err != nil {\nreturn err\n}\n", x)
+		default:
+			g.decode(x, ft, "value", 0)
+		}
+	}
+	if rest != nil {
+		g.printf("default:\n")
+		x, ptrs := fieldExpr(*rest)
+		g.allocPtrs(ptrs, *rest)
+		g.printf("if %s == nil {\n%s = make(%s)\n}\n", x, x, g.typeString(rest.typ))
+		g.printf("%s[string(key)] = append(bencode.RawMessage(nil), value...)\n", x)
+	}
+	g.printf("}\nreturn nil\n})\n}\n")
+}
+
+// allocPtrs writes the code that allocates the nil embedded
+// pointers ptrs on the way to f. As in the bencode package, a
+// nil pointer to an unexported type, which reflection cannot
+// set, is an error.
+func (g *generator) allocPtrs(ptrs []string, f field) {
+	for _, p := range ptrs {
+		sf := fieldVar(p, f)
+		pt := sf.Type().(*types.Pointer).Elem()
+		if !sf.Exported() {
+			g.imports["errors"] = "errors"
+			msg := "bencode: cannot set embedded pointer to unexported struct: " + types.TypeString(pt, (*types.Package).Name)
+			g.printf("if %s == nil {\nreturn errors.New(%q)\n}\n", p, msg)
+			continue
+		}
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", p, p, g.typeString(pt))
+	}
+}
+
+// fieldVar returns the embedded field at expression p on the way to f.
+func fieldVar(p string, f field) *types.Var {
+	x := "v"
+	for _, sf := range f.path {
+		x += "." + sf.Name()
+		if x == p {
+			return sf
+		}
+	}
+	panic("bencodegen: no field " + p)
+}
+
+// decodeQuoted writes the code that decodes value, a decimal
+// string or an integer, into the number x of type t.
+func (g *generator) decodeQuoted(x string, t types.Type) {
+	g.imports["strconv"] = "strconv"
+	var parse string
+	switch i := t.Underlying().(*types.Basic).Info(); {
+	case i&types.IsFloat != 0:
+		parse = fmt.Sprintf("strconv.ParseFloat(string(s), %d)", basicBits(t))
+	case i&types.IsUnsigned != 0:
+		parse = fmt.Sprintf("strconv.ParseUint(string(s), 10, %d)", basicBits(t))
+	default:
+		parse = fmt.Sprintf("strconv.ParseInt(string(s), 10, %d)", basicBits(t))
+	}
+	g.printf("if c := value[0]; '0' <= c && c <= '9' {\n")
+	g.printf("s, err := bencode.ParseString(value)\nif err != nil {\nreturn err\n}\n")
+	g.printf("n, err := %s\nif err != nil {\n", parse)
+	g.printf("return bencode.NewUnmarshalTypeError(value, reflect.TypeOf(%s))\n}\n", x)
+	g.printf("%s = %s(n)\n", x, g.typeString(t))
+	g.printf("} else if err := bencode.UnmarshalField(value, &%s); err != nil {\nreturn err\n}\n", x)
+}
+
+// decode writes the code that decodes raw into x of type t.
+func (g *generator) decode(x string, t types.Type, raw string, depth int) {
+	fallback := fmt.Sprintf("if err := bencode.UnmarshalField(%s, &%s); err != nil {\nreturn err\n}\n", raw, x)
+	k := g.kind(t)
+	if k == kindBytes && !isByteSlice(t) {
+		// Unmarshal only decodes strings into []byte itself.
+		k = kindOther
+	}
+	switch k {
+	case kindString, kindBytes:
+		s := fmt.Sprintf("s%d", depth)
+		g.printf("if c := %s[0]; '0' <= c && c <= '9' {\n", raw)
+		g.printf("%s, err := bencode.ParseString(%s)\nif err != nil {\nreturn err\n}\n", s, raw)
+		if k == kindBytes {
+			g.printf("%s = append(make([]byte, 0, len(%s)), %s...)\n", x, s, s)
+		} else {
+			g.printf("%s = %s(%s)\n", x, g.typeString(t), s)
+		}
+		g.printf("} else ")
+		g.w.WriteString(fallback)
+	case kindInt, kindUint:
+		n := fmt.Sprintf("n%d", depth)
+		parse := "ParseInt"
+		if k == kindUint {
+			parse = "ParseUint"
+		}
+		g.printf("if %s[0] == 'i' {\n", raw)
+		g.printf("%s, err := bencode.%s(%s)\nif err != nil {\nreturn err\n}\n", n, parse, raw)
+		g.printf("%s = %s(%s)\n", x, g.typeString(t), n)
+		g.printf("} else ")
+		g.w.WriteString(fallback)
+	case kindStruct:
+		g.printf("if err := %s.UnmarshalBencode(%s); err != nil {\nreturn err\n}\n", x, raw)
+	case kindPtr:
+		g.printf("if %s == nil {\n%s = new(%s)\n}\n", x, x, g.typeString(t.(*types.Pointer).Elem()))
+		g.printf("if err := %s.UnmarshalBencode(%s); err != nil {\nreturn err\n}\n", x, raw)
+	case kindSlice:
+		// Like Unmarshal, append to the slice, reusing its
+		// capacity, and leave it empty rather than nil.
+		s, e := fmt.Sprintf("s%d", depth), fmt.Sprintf("e%d", depth)
+		elem := t.Underlying().(*types.Slice).Elem()
+		g.printf("if %s[0] == 'l' {\n%s := %s\n", raw, s, x)
+		g.printf("if err := bencode.ForEachElement(%s, func(%s []byte) error {\n", raw, e)
+		g.printf("if len(%s) < cap(%s) {\n%s = %s[:len(%s)+1]\n", s, s, s, s, s)
+		g.printf("} else {\nvar z %s\n%s = append(%s, z)\n}\n", g.typeString(elem), s, s)
+		g.decode(fmt.Sprintf("%s[len(%s)-1]", s, s), elem, e, depth+1)
+		g.printf("return nil\n}); err != nil {\nreturn err\n}\n")
+		g.printf("if len(%s) == 0 {\n%s = %s{}\n}\n", s, s, g.typeString(t))
+		g.printf("%s = %s\n", x, s)
+		g.printf("} else ")
+		g.w.WriteString(fallback)
+	default:
+		g.w.WriteString(fallback)
+	}
+}
@@ -0,0 +1,218 @@
+package gentest
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// The plain types have the fields of the generated types but not
+// their methods, so Marshal and Unmarshal use reflection on them.
+// Their fields of generated types still use the generated methods,
+// which are tested against reflection as types of their own.
+type (
+	plainTorrent Torrent
+	plainInfo    Info
+	plainFile    File
+	plainMixed   Mixed
+)
+
+var torrent = Torrent{
+	Announce:     "http://tracker/announce",
+	AnnounceList: [][]string{{"http://tracker/announce"}, {"udp://a:80", "udp://b:80"}},
+	CreationDate: 1400000000,
+	Info: Info{
+		Files: []*File{
+			{Length: 5, Path: []string{"a", "b"}, MD5: Hash{0xff, 0}},
+			nil,
+			{Length: 0, Path: nil},
+		},
+		Name:        "dir",
+		PieceLength: 1 << 18,
+		Pieces:      []byte("\x00\x01\x02"),
+		Private:     1,
+	},
+	URLList: []string{"http://seed/"},
+	Extra: map[string]bencode.RawMessage{
+		"a":       bencode.RawMessage("i1e"),
+		"comment": bencode.RawMessage("1:x"),
+		"zz":      bencode.RawMessage("de"),
+	},
+}
+
+var mixed = Mixed{
+	Base:    Base{ID: 1, Name: "base", Dup: 2, Tag: 3},
+	Other:   &Other{Dup: 4, Extra: 5, Unknown: map[string]bencode.RawMessage{"0": nil, "~": bencode.RawMessage("le")}},
+	stats:   stats{Seen: 3},
+	note:    &note{Note: "n"},
+	Name:    "mixed",
+	Kind:    "k",
+	Level:   7,
+	Any:     []interface{}{int64(1), "x"},
+	Ptr:     &Info{Name: "ptr"},
+	Files:   []File{{Length: 1}},
+	Counts:  map[string]int{"b": 2, "a": 1},
+	Raw:     bencode.RawMessage("li1ee"),
+	Small:   -8,
+	U:       16,
+	Hidden:  9,
+	Created: time.Unix(1400000000, 0),
+	Stamp:   time.Unix(1400000000, 123456789),
+	Port:    6881,
+	Ratio:   0.1,
+	Delta:   -1,
+}
+
+func TestMarshal(t *testing.T) {
+	for _, tt := range []struct{ gen, plain interface{} }{
+		{Torrent{}, plainTorrent{}},
+		{torrent, plainTorrent(torrent)},
+		{torrent.Info, plainInfo(torrent.Info)},
+		{*torrent.Info.Files[0], plainFile(*torrent.Info.Files[0])},
+		{Mixed{}, plainMixed{}},
+		{mixed, plainMixed(mixed)},
+		{Mixed{Flag: true}, plainMixed{Flag: true}},
+		{Mixed{Any: make(chan int)}, plainMixed{Any: make(chan int)}},
+	} {
+		got, err := bencode.Marshal(tt.gen)
+		want, wantErr := bencode.Marshal(tt.plain)
+		if (err == nil) != (wantErr == nil) {
+			t.Errorf("Marshal(%+v): got error %v, want %v", tt.gen, err, wantErr)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("Marshal(%+v):\ngot  %q\nwant %q", tt.gen, got, want)
+		}
+	}
+}
+
+var unmarshalTests = []struct {
+	in  string
+	new func() (gen, plain interface{})
+}{
+	{"", newTorrent},
+	{"d8:announce3:url4:infod4:name1:n12:piece lengthi16e6:pieces0:ee", newTorrent},
+	{"d8:ANNOUNCE3:url7:commenti5e3:zzzli1ee8:url-listl1:ai2eee", newTorrent},
+	{"d8:url-listi1ee", newTorrent},
+	{"d13:announce-listll1:aeli1eeee", newTorrent},
+	{"d4:infoi1ee", newTorrent},
+	{"d4:infod5:filesld6:lengthi1eed6:length1:xeeee", newTorrent},
+	{"d4:infod5:filesld4:pathl1:ali1eeeeeee", newTorrent},
+	{"i1e", newTorrent},
+	{"d8:announce", newTorrent},
+	{"d5:filesld6:lengthi1e4:pathl1:aeed6:lengthi-1eee6:md5sum0:e", newInfo},
+	{"d5:filesl0:ee", newInfo},
+	{"d12:piece lengthi-1ee", newInfo},
+	{"d6:lengthi99999999999999999999ee", newInfo},
+	{"d6:md5sum2:xxe", newFile},
+	{"d1:-i1e5:Extrai5e3:Dupi2e4:NAME1:a4:name1:b5:smalli300e4:kindi7e5:level2:L43:rawli1ee3:anyl1:xe3:ptrd4:name1:pee", newMixed},
+	{"d5:filesld4:pathl1:aeeee", newMixed},
+	{"d5:level1:xe", newMixed},
+	{"d1:ui-1ee", newMixed},
+	{"d4:flagi1ee", newMixed},
+	{"d7:createdi1400000000e5:stampi1400000000123e4:port4:68815:ratio3:0.15:delta2:-1e", newMixed},
+	{"d4:porti80e5:ratioi2e5:deltai-2e", newMixed},
+	{"d5:delta3:300e", newMixed},
+	{"d4:port2:-1e", newMixed},
+	{"d5:ratio1:xe", newMixed},
+	{"d5:stamp1:xe", newMixed},
+	{"d7:created1:xe", newMixed},
+	{"d1:ai1e4:infod4:name1:ne1:zl1:xee", newTorrent},
+	{"d1:ai1e1:zl1:xee", newMixed},
+	{"d4:seeni4ee", newMixed},
+	{"d4:note1:ne", newMixed},
+	{"d1:ai1e4:note1:n4:seeni4ee", newMixed},
+}
+
+func newTorrent() (interface{}, interface{}) { return new(Torrent), new(plainTorrent) }
+func newInfo() (interface{}, interface{})    { return new(Info), new(plainInfo) }
+func newFile() (interface{}, interface{})    { return new(File), new(plainFile) }
+
+// newMixed returns values with a slice to be appended to,
+// with an element beyond its length that will be reused.
+func newMixed() (interface{}, interface{}) {
+	files := []File{{Length: 1}, {Length: 2}}
+	gen := &Mixed{Files: files[:1]}
+	files = []File{{Length: 1}, {Length: 2}}
+	plain := &plainMixed{Files: files[:1]}
+	return gen, plain
+}
+
+func TestUnmarshal(t *testing.T) {
+	for _, tt := range unmarshalTests {
+		gen, plain := tt.new()
+		err := bencode.Unmarshal([]byte(tt.in), gen)
+		wantErr := bencode.Unmarshal([]byte(tt.in), plain)
+		if (err == nil) != (wantErr == nil) {
+			t.Errorf("Unmarshal(%q): got error %v, want %v", tt.in, err, wantErr)
+			continue
+		}
+		if err != nil {
+			// The errors differ only in the names of the types.
+			want := strings.Replace(wantErr.Error(), "gentest.plain", "gentest.", -1)
+			if err.Error() != want || errorOffset(err) != errorOffset(wantErr) {
+				t.Errorf("Unmarshal(%q): got error %v at %d, want %v at %d", tt.in, err, errorOffset(err), want, errorOffset(wantErr))
+			}
+			// What is left of a value after an error may differ.
+			continue
+		}
+		// Convert the plain value to the generated type to compare them.
+		want := reflect.ValueOf(plain).Elem().Convert(reflect.TypeOf(gen).Elem()).Interface()
+		if got := reflect.ValueOf(gen).Elem().Interface(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Unmarshal(%q):\ngot  %+v\nwant %+v", tt.in, got, want)
+		}
+	}
+}
+
+// errorOffset returns the offset that err carries, or -1.
+func errorOffset(err error) int64 {
+	switch e := err.(type) {
+	case *bencode.UnmarshalTypeError:
+		return e.Offset
+	case *bencode.FieldError:
+		return e.Offset
+	case *bencode.SyntaxError:
+		return e.Offset
+	}
+	return -1
+}
+
+func TestTypeError(t *testing.T) {
+	var f File
+	err := f.UnmarshalBencode([]byte("i1e"))
+	if err == nil || err.Error() != "bencode: cannot unmarshal integer 1 into Go value of type gentest.File" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func BenchmarkMarshalGenerated(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		torrent.MarshalBencode()
+	}
+}
+
+func BenchmarkMarshalReflect(b *testing.B) {
+	plain := plainTorrent(torrent)
+	for i := 0; i < b.N; i++ {
+		bencode.Marshal(plain)
+	}
+}
+
+func BenchmarkUnmarshalGenerated(b *testing.B) {
+	data, _ := bencode.Marshal(torrent)
+	for i := 0; i < b.N; i++ {
+		var t Torrent
+		t.UnmarshalBencode(data)
+	}
+}
+
+func BenchmarkUnmarshalReflect(b *testing.B) {
+	data, _ := bencode.Marshal(torrent)
+	for i := 0; i < b.N; i++ {
+		var t plainTorrent
+		bencode.Unmarshal(data, &t)
+	}
+}
@@ -0,0 +1,110 @@
+// Package gentest holds types for testing the methods
+// generated by bencodegen against reflection.
+package gentest
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+//go:generate go run github.com/ehmry/encoding/bencode/cmd/bencodegen -type Torrent,Info,File,Mixed -output types_bencode.go
+
+type Torrent struct {
+	Announce     string     `bencode:"announce"`
+	AnnounceList [][]string `bencode:"announce-list,omitempty"`
+	Comment      string     `bencode:"comment,omitempty"`
+	CreationDate int64      `bencode:"creation date,omitempty"`
+	Info         Info       `bencode:"info"`
+	URLList      []string   `bencode:"url-list,omitempty"`
+
+	Extra map[string]bencode.RawMessage `bencode:",rest"`
+}
+
+type Info struct {
+	Files       []*File `bencode:"files,omitempty"`
+	Length      int64   `bencode:"length,omitempty"`
+	Name        string  `bencode:"name"`
+	PieceLength uint32  `bencode:"piece length"`
+	Pieces      []byte  `bencode:"pieces"`
+	Private     int     `bencode:"private,omitempty"`
+}
+
+type File struct {
+	Length int64    `bencode:"length"`
+	MD5    Hash     `bencode:"md5sum,omitempty"`
+	Path   []string `bencode:"path"`
+}
+
+// Hash is encoded as a string, but
+// Unmarshal does not decode into it.
+type Hash []byte
+
+type Kind string
+
+// Level is encoded as text.
+type Level int
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte("L" + strconv.Itoa(int(l))), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	if len(b) < 2 || b[0] != 'L' {
+		return errors.New("gentest: invalid level")
+	}
+	n, err := strconv.Atoi(string(b[1:]))
+	*l = Level(n)
+	return err
+}
+
+type Base struct {
+	ID   int
+	Name string `bencode:"name"`
+	Dup  int
+	Tag  int `bencode:"Small"`
+}
+
+type Other struct {
+	Dup   int
+	Extra uint8 `bencode:",omitempty"`
+
+	Unknown map[string]bencode.RawMessage `bencode:",rest"`
+}
+
+// The fields of embedded structs of unexported types are promoted.
+type stats struct {
+	Seen int `bencode:"seen,omitempty"`
+}
+
+type note struct {
+	Note string `bencode:"note,omitempty"`
+}
+
+type Mixed struct {
+	Base
+	*Other
+	stats
+	*note
+	Name    string
+	Kind    Kind               `bencode:"kind"`
+	Level   Level              `bencode:"level"`
+	Ignored string             `bencode:"-"`
+	Any     interface{}        `bencode:"any,omitempty"`
+	Ptr     *Info              `bencode:"ptr,omitempty"`
+	Files   []File             `bencode:"files,omitempty"`
+	Counts  map[string]int     `bencode:"counts,omitempty"`
+	Raw     bencode.RawMessage `bencode:"raw,omitempty"`
+	Small   int8
+	U       uint16    `bencode:"u,omitempty"`
+	Flag    bool      `bencode:"flag,omitempty"`
+	Created time.Time `bencode:"created,omitempty"`
+	Stamp   time.Time `bencode:"stamp,unixms,omitempty"`
+	Port    uint16    `bencode:"port,string,omitempty"`
+	Ratio   float32   `bencode:"ratio,string,omitempty"`
+	Delta   int8      `bencode:"delta,string"`
+	Hidden  int       `bencode:"-,"`
+	private int
+}
@@ -0,0 +1,926 @@
+// Code generated by "bencodegen -type Torrent,Info,File,Mixed -output types_bencode.go"; DO NOT EDIT.
+
+package gentest
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// MarshalBencode implements bencode.Marshaler.
+func (v Torrent) MarshalBencode() ([]byte, error) {
+	return v.appendBencode(nil)
+}
+
+func (v Torrent) appendBencode(b []byte) ([]byte, error) {
+	var err error
+	b = append(b, 'd')
+	var rest []string
+	if v.Extra != nil {
+		rest = bencode.RestKeys(v.Extra, bencodeKeysTorrent)
+	}
+	for ; len(rest) > 0 && rest[0] < "announce"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "8:announce"...)
+	b = bencode.AppendString(b, v.Announce)
+	for ; len(rest) > 0 && rest[0] < "announce-list"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.AnnounceList) != 0 {
+		b = append(b, "13:announce-list"...)
+		b = append(b, 'l')
+		for _, e0 := range v.AnnounceList {
+			b = append(b, 'l')
+			for _, e1 := range e0 {
+				b = bencode.AppendString(b, e1)
+			}
+			b = append(b, 'e')
+		}
+		b = append(b, 'e')
+	}
+	for ; len(rest) > 0 && rest[0] < "comment"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Comment != "" {
+		b = append(b, "7:comment"...)
+		b = bencode.AppendString(b, v.Comment)
+	}
+	for ; len(rest) > 0 && rest[0] < "creation date"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.CreationDate != 0 {
+		b = append(b, "13:creation date"...)
+		b = bencode.AppendInt(b, int64(v.CreationDate))
+	}
+	for ; len(rest) > 0 && rest[0] < "info"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "4:info"...)
+	if b, err = v.Info.appendBencode(b); err != nil {
+		return nil, err
+	}
+	for ; len(rest) > 0 && rest[0] < "url-list"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Extra[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.URLList) != 0 {
+		b = append(b, "8:url-list"...)
+		b = append(b, 'l')
+		for _, e0 := range v.URLList {
+			b = bencode.AppendString(b, e0)
+		}
+		b = append(b, 'e')
+	}
+	for _, k := range rest {
+		b = bencode.AppendString(b, k)
+		if b, err = bencode.AppendMarshal(b, v.Extra[k]); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, 'e'), nil
+}
+
+var bencodeKeysTorrent = []string{"announce", "announce-list", "comment", "creation date", "info", "url-list"}
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (v *Torrent) UnmarshalBencode(b []byte) error {
+	if len(b) == 0 || b[0] != 'd' {
+		return bencode.NewUnmarshalTypeError(b, reflect.TypeOf(v).Elem())
+	}
+	return bencode.ForEachEntry(b, func(key, value []byte) error {
+		switch bencode.MatchKey(key, bencodeKeysTorrent) {
+		case 0:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Announce = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Announce); err != nil {
+				return err
+			}
+		case 1:
+			if value[0] == 'l' {
+				s0 := v.AnnounceList
+				if err := bencode.ForEachElement(value, func(e0 []byte) error {
+					if len(s0) < cap(s0) {
+						s0 = s0[:len(s0)+1]
+					} else {
+						var z []string
+						s0 = append(s0, z)
+					}
+					if e0[0] == 'l' {
+						s1 := s0[len(s0)-1]
+						if err := bencode.ForEachElement(e0, func(e1 []byte) error {
+							if len(s1) < cap(s1) {
+								s1 = s1[:len(s1)+1]
+							} else {
+								var z string
+								s1 = append(s1, z)
+							}
+							if c := e1[0]; '0' <= c && c <= '9' {
+								s2, err := bencode.ParseString(e1)
+								if err != nil {
+									return err
+								}
+								s1[len(s1)-1] = string(s2)
+							} else if err := bencode.UnmarshalField(e1, &s1[len(s1)-1]); err != nil {
+								return err
+							}
+							return nil
+						}); err != nil {
+							return err
+						}
+						if len(s1) == 0 {
+							s1 = []string{}
+						}
+						s0[len(s0)-1] = s1
+					} else if err := bencode.UnmarshalField(e0, &s0[len(s0)-1]); err != nil {
+						return err
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(s0) == 0 {
+					s0 = [][]string{}
+				}
+				v.AnnounceList = s0
+			} else if err := bencode.UnmarshalField(value, &v.AnnounceList); err != nil {
+				return err
+			}
+		case 2:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Comment = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Comment); err != nil {
+				return err
+			}
+		case 3:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.CreationDate = int64(n0)
+			} else if err := bencode.UnmarshalField(value, &v.CreationDate); err != nil {
+				return err
+			}
+		case 4:
+			if err := v.Info.UnmarshalBencode(value); err != nil {
+				return err
+			}
+		case 5:
+			if value[0] == 'l' {
+				s0 := v.URLList
+				if err := bencode.ForEachElement(value, func(e0 []byte) error {
+					if len(s0) < cap(s0) {
+						s0 = s0[:len(s0)+1]
+					} else {
+						var z string
+						s0 = append(s0, z)
+					}
+					if c := e0[0]; '0' <= c && c <= '9' {
+						s1, err := bencode.ParseString(e0)
+						if err != nil {
+							return err
+						}
+						s0[len(s0)-1] = string(s1)
+					} else if err := bencode.UnmarshalField(e0, &s0[len(s0)-1]); err != nil {
+						return err
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(s0) == 0 {
+					s0 = []string{}
+				}
+				v.URLList = s0
+			} else if err := bencode.UnmarshalField(value, &v.URLList); err != nil {
+				return err
+			}
+		default:
+			if v.Extra == nil {
+				v.Extra = make(map[string]bencode.RawMessage)
+			}
+			v.Extra[string(key)] = append(bencode.RawMessage(nil), value...)
+		}
+		return nil
+	})
+}
+
+// MarshalBencode implements bencode.Marshaler.
+func (v Info) MarshalBencode() ([]byte, error) {
+	return v.appendBencode(nil)
+}
+
+func (v Info) appendBencode(b []byte) ([]byte, error) {
+	var err error
+	b = append(b, 'd')
+	if len(v.Files) != 0 {
+		b = append(b, "5:files"...)
+		b = append(b, 'l')
+		for _, e0 := range v.Files {
+			if e0 == nil {
+				b = append(b, "0:"...)
+			} else if b, err = e0.appendBencode(b); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, 'e')
+	}
+	if v.Length != 0 {
+		b = append(b, "6:length"...)
+		b = bencode.AppendInt(b, int64(v.Length))
+	}
+	b = append(b, "4:name"...)
+	b = bencode.AppendString(b, v.Name)
+	b = append(b, "12:piece length"...)
+	b = bencode.AppendUint(b, uint64(v.PieceLength))
+	b = append(b, "6:pieces"...)
+	b = bencode.AppendBytes(b, v.Pieces)
+	if v.Private != 0 {
+		b = append(b, "7:private"...)
+		b = bencode.AppendInt(b, int64(v.Private))
+	}
+	return append(b, 'e'), nil
+}
+
+var bencodeKeysInfo = []string{"files", "length", "name", "piece length", "pieces", "private"}
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (v *Info) UnmarshalBencode(b []byte) error {
+	if len(b) == 0 || b[0] != 'd' {
+		return bencode.NewUnmarshalTypeError(b, reflect.TypeOf(v).Elem())
+	}
+	return bencode.ForEachEntry(b, func(key, value []byte) error {
+		switch bencode.MatchKey(key, bencodeKeysInfo) {
+		case 0:
+			if value[0] == 'l' {
+				s0 := v.Files
+				if err := bencode.ForEachElement(value, func(e0 []byte) error {
+					if len(s0) < cap(s0) {
+						s0 = s0[:len(s0)+1]
+					} else {
+						var z *File
+						s0 = append(s0, z)
+					}
+					if s0[len(s0)-1] == nil {
+						s0[len(s0)-1] = new(File)
+					}
+					if err := s0[len(s0)-1].UnmarshalBencode(e0); err != nil {
+						return err
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(s0) == 0 {
+					s0 = []*File{}
+				}
+				v.Files = s0
+			} else if err := bencode.UnmarshalField(value, &v.Files); err != nil {
+				return err
+			}
+		case 1:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Length = int64(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Length); err != nil {
+				return err
+			}
+		case 2:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Name = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Name); err != nil {
+				return err
+			}
+		case 3:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseUint(value)
+				if err != nil {
+					return err
+				}
+				v.PieceLength = uint32(n0)
+			} else if err := bencode.UnmarshalField(value, &v.PieceLength); err != nil {
+				return err
+			}
+		case 4:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Pieces = append(make([]byte, 0, len(s0)), s0...)
+			} else if err := bencode.UnmarshalField(value, &v.Pieces); err != nil {
+				return err
+			}
+		case 5:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Private = int(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Private); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarshalBencode implements bencode.Marshaler.
+func (v File) MarshalBencode() ([]byte, error) {
+	return v.appendBencode(nil)
+}
+
+func (v File) appendBencode(b []byte) ([]byte, error) {
+	b = append(b, 'd')
+	b = append(b, "6:length"...)
+	b = bencode.AppendInt(b, int64(v.Length))
+	if len(v.MD5) != 0 {
+		b = append(b, "6:md5sum"...)
+		b = bencode.AppendBytes(b, v.MD5)
+	}
+	b = append(b, "4:path"...)
+	b = append(b, 'l')
+	for _, e0 := range v.Path {
+		b = bencode.AppendString(b, e0)
+	}
+	b = append(b, 'e')
+	return append(b, 'e'), nil
+}
+
+var bencodeKeysFile = []string{"length", "md5sum", "path"}
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (v *File) UnmarshalBencode(b []byte) error {
+	if len(b) == 0 || b[0] != 'd' {
+		return bencode.NewUnmarshalTypeError(b, reflect.TypeOf(v).Elem())
+	}
+	return bencode.ForEachEntry(b, func(key, value []byte) error {
+		switch bencode.MatchKey(key, bencodeKeysFile) {
+		case 0:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Length = int64(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Length); err != nil {
+				return err
+			}
+		case 1:
+			if err := bencode.UnmarshalField(value, &v.MD5); err != nil {
+				return err
+			}
+		case 2:
+			if value[0] == 'l' {
+				s0 := v.Path
+				if err := bencode.ForEachElement(value, func(e0 []byte) error {
+					if len(s0) < cap(s0) {
+						s0 = s0[:len(s0)+1]
+					} else {
+						var z string
+						s0 = append(s0, z)
+					}
+					if c := e0[0]; '0' <= c && c <= '9' {
+						s1, err := bencode.ParseString(e0)
+						if err != nil {
+							return err
+						}
+						s0[len(s0)-1] = string(s1)
+					} else if err := bencode.UnmarshalField(e0, &s0[len(s0)-1]); err != nil {
+						return err
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(s0) == 0 {
+					s0 = []string{}
+				}
+				v.Path = s0
+			} else if err := bencode.UnmarshalField(value, &v.Path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// MarshalBencode implements bencode.Marshaler.
+func (v Mixed) MarshalBencode() ([]byte, error) {
+	return v.appendBencode(nil)
+}
+
+func (v Mixed) appendBencode(b []byte) ([]byte, error) {
+	var err error
+	b = append(b, 'd')
+	var rest []string
+	if v.Other != nil && v.Other.Unknown != nil {
+		rest = bencode.RestKeys(v.Other.Unknown, bencodeKeysMixed)
+	}
+	for ; len(rest) > 0 && rest[0] < "-"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "1:-"...)
+	b = bencode.AppendInt(b, int64(v.Hidden))
+	for ; len(rest) > 0 && rest[0] < "Extra"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Other != nil && v.Other.Extra != 0 {
+		b = append(b, "5:Extra"...)
+		b = bencode.AppendUint(b, uint64(v.Other.Extra))
+	}
+	for ; len(rest) > 0 && rest[0] < "ID"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "2:ID"...)
+	b = bencode.AppendInt(b, int64(v.Base.ID))
+	for ; len(rest) > 0 && rest[0] < "Name"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "4:Name"...)
+	b = bencode.AppendString(b, v.Name)
+	for ; len(rest) > 0 && rest[0] < "Small"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "5:Small"...)
+	b = bencode.AppendInt(b, int64(v.Small))
+	for ; len(rest) > 0 && rest[0] < "any"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Any != nil {
+		b = append(b, "3:any"...)
+		if b, err = bencode.AppendMarshal(b, v.Any); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "counts"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.Counts) != 0 {
+		b = append(b, "6:counts"...)
+		if b, err = bencode.AppendMarshal(b, v.Counts); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "created"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if !v.Created.IsZero() {
+		b = append(b, "7:created"...)
+		if b, err = bencode.AppendMarshal(b, v.Created); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "delta"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "5:delta"...)
+	b = bencode.AppendString(b, strconv.FormatInt(int64(v.Delta), 10))
+	for ; len(rest) > 0 && rest[0] < "files"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.Files) != 0 {
+		b = append(b, "5:files"...)
+		b = append(b, 'l')
+		for _, e0 := range v.Files {
+			if b, err = e0.appendBencode(b); err != nil {
+				return nil, err
+			}
+		}
+		b = append(b, 'e')
+	}
+	for ; len(rest) > 0 && rest[0] < "flag"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Flag {
+		b = append(b, "4:flag"...)
+		if b, err = bencode.AppendMarshal(b, v.Flag); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "kind"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "4:kind"...)
+	b = bencode.AppendString(b, string(v.Kind))
+	for ; len(rest) > 0 && rest[0] < "level"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "5:level"...)
+	if b, err = bencode.AppendMarshal(b, v.Level); err != nil {
+		return nil, err
+	}
+	for ; len(rest) > 0 && rest[0] < "name"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	b = append(b, "4:name"...)
+	b = bencode.AppendString(b, v.Base.Name)
+	for ; len(rest) > 0 && rest[0] < "note"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.note != nil && v.note.Note != "" {
+		b = append(b, "4:note"...)
+		b = bencode.AppendString(b, v.note.Note)
+	}
+	for ; len(rest) > 0 && rest[0] < "port"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Port != 0 {
+		b = append(b, "4:port"...)
+		b = bencode.AppendString(b, strconv.FormatUint(uint64(v.Port), 10))
+	}
+	for ; len(rest) > 0 && rest[0] < "ptr"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Ptr != nil {
+		b = append(b, "3:ptr"...)
+		if v.Ptr == nil {
+			b = append(b, "0:"...)
+		} else if b, err = v.Ptr.appendBencode(b); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "ratio"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.Ratio != 0 {
+		b = append(b, "5:ratio"...)
+		b = bencode.AppendString(b, strconv.FormatFloat(float64(v.Ratio), 'g', -1, 32))
+	}
+	for ; len(rest) > 0 && rest[0] < "raw"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.Raw) != 0 {
+		b = append(b, "3:raw"...)
+		if b, err = bencode.AppendMarshal(b, v.Raw); err != nil {
+			return nil, err
+		}
+	}
+	for ; len(rest) > 0 && rest[0] < "seen"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.stats.Seen != 0 {
+		b = append(b, "4:seen"...)
+		b = bencode.AppendInt(b, int64(v.stats.Seen))
+	}
+	for ; len(rest) > 0 && rest[0] < "stamp"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if !v.Stamp.IsZero() {
+		b = append(b, "5:stamp"...)
+		b = bencode.AppendInt(b, v.Stamp.Unix()*1000+int64(v.Stamp.Nanosecond()/1e6))
+	}
+	for ; len(rest) > 0 && rest[0] < "u"; rest = rest[1:] {
+		b = bencode.AppendString(b, rest[0])
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[rest[0]]); err != nil {
+			return nil, err
+		}
+	}
+	if v.U != 0 {
+		b = append(b, "1:u"...)
+		b = bencode.AppendUint(b, uint64(v.U))
+	}
+	for _, k := range rest {
+		b = bencode.AppendString(b, k)
+		if b, err = bencode.AppendMarshal(b, v.Other.Unknown[k]); err != nil {
+			return nil, err
+		}
+	}
+	return append(b, 'e'), nil
+}
+
+var bencodeKeysMixed = []string{"-", "Extra", "ID", "Name", "Small", "any", "counts", "created", "delta", "files", "flag", "kind", "level", "name", "note", "port", "ptr", "ratio", "raw", "seen", "stamp", "u"}
+
+// UnmarshalBencode implements bencode.Unmarshaler.
+func (v *Mixed) UnmarshalBencode(b []byte) error {
+	if len(b) == 0 || b[0] != 'd' {
+		return bencode.NewUnmarshalTypeError(b, reflect.TypeOf(v).Elem())
+	}
+	return bencode.ForEachEntry(b, func(key, value []byte) error {
+		switch bencode.MatchKey(key, bencodeKeysMixed) {
+		case 0:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Hidden = int(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Hidden); err != nil {
+				return err
+			}
+		case 1:
+			if v.Other == nil {
+				v.Other = new(Other)
+			}
+			if value[0] == 'i' {
+				n0, err := bencode.ParseUint(value)
+				if err != nil {
+					return err
+				}
+				v.Other.Extra = uint8(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Other.Extra); err != nil {
+				return err
+			}
+		case 2:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Base.ID = int(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Base.ID); err != nil {
+				return err
+			}
+		case 3:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Name = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Name); err != nil {
+				return err
+			}
+		case 4:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Small = int8(n0)
+			} else if err := bencode.UnmarshalField(value, &v.Small); err != nil {
+				return err
+			}
+		case 5:
+			if err := bencode.UnmarshalField(value, &v.Any); err != nil {
+				return err
+			}
+		case 6:
+			if err := bencode.UnmarshalField(value, &v.Counts); err != nil {
+				return err
+			}
+		case 7:
+			if err := bencode.UnmarshalField(value, &v.Created); err != nil {
+				return err
+			}
+		case 8:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				n, err := strconv.ParseInt(string(s), 10, 8)
+				if err != nil {
+					return bencode.NewUnmarshalTypeError(value, reflect.TypeOf(v.Delta))
+				}
+				v.Delta = int8(n)
+			} else if err := bencode.UnmarshalField(value, &v.Delta); err != nil {
+				return err
+			}
+		case 9:
+			if value[0] == 'l' {
+				s0 := v.Files
+				if err := bencode.ForEachElement(value, func(e0 []byte) error {
+					if len(s0) < cap(s0) {
+						s0 = s0[:len(s0)+1]
+					} else {
+						var z File
+						s0 = append(s0, z)
+					}
+					if err := s0[len(s0)-1].UnmarshalBencode(e0); err != nil {
+						return err
+					}
+					return nil
+				}); err != nil {
+					return err
+				}
+				if len(s0) == 0 {
+					s0 = []File{}
+				}
+				v.Files = s0
+			} else if err := bencode.UnmarshalField(value, &v.Files); err != nil {
+				return err
+			}
+		case 10:
+			if err := bencode.UnmarshalField(value, &v.Flag); err != nil {
+				return err
+			}
+		case 11:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Kind = Kind(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Kind); err != nil {
+				return err
+			}
+		case 12:
+			if err := bencode.UnmarshalField(value, &v.Level); err != nil {
+				return err
+			}
+		case 13:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.Base.Name = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.Base.Name); err != nil {
+				return err
+			}
+		case 14:
+			if v.note == nil {
+				return errors.New("bencode: cannot set embedded pointer to unexported struct: gentest.note")
+			}
+			if c := value[0]; '0' <= c && c <= '9' {
+				s0, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				v.note.Note = string(s0)
+			} else if err := bencode.UnmarshalField(value, &v.note.Note); err != nil {
+				return err
+			}
+		case 15:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				n, err := strconv.ParseUint(string(s), 10, 16)
+				if err != nil {
+					return bencode.NewUnmarshalTypeError(value, reflect.TypeOf(v.Port))
+				}
+				v.Port = uint16(n)
+			} else if err := bencode.UnmarshalField(value, &v.Port); err != nil {
+				return err
+			}
+		case 16:
+			if v.Ptr == nil {
+				v.Ptr = new(Info)
+			}
+			if err := v.Ptr.UnmarshalBencode(value); err != nil {
+				return err
+			}
+		case 17:
+			if c := value[0]; '0' <= c && c <= '9' {
+				s, err := bencode.ParseString(value)
+				if err != nil {
+					return err
+				}
+				n, err := strconv.ParseFloat(string(s), 32)
+				if err != nil {
+					return bencode.NewUnmarshalTypeError(value, reflect.TypeOf(v.Ratio))
+				}
+				v.Ratio = float32(n)
+			} else if err := bencode.UnmarshalField(value, &v.Ratio); err != nil {
+				return err
+			}
+		case 18:
+			if err := bencode.UnmarshalField(value, &v.Raw); err != nil {
+				return err
+			}
+		case 19:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.stats.Seen = int(n0)
+			} else if err := bencode.UnmarshalField(value, &v.stats.Seen); err != nil {
+				return err
+			}
+		case 20:
+			if value[0] == 'i' {
+				n, err := bencode.ParseInt(value)
+				if err != nil {
+					return err
+				}
+				v.Stamp = time.Unix(n/1000, n%1000*1e6)
+			} else if err := bencode.UnmarshalField(value, &v.Stamp); err != nil {
+				return err
+			}
+		case 21:
+			if value[0] == 'i' {
+				n0, err := bencode.ParseUint(value)
+				if err != nil {
+					return err
+				}
+				v.U = uint16(n0)
+			} else if err := bencode.UnmarshalField(value, &v.U); err != nil {
+				return err
+			}
+		default:
+			if v.Other == nil {
+				v.Other = new(Other)
+			}
+			if v.Other.Unknown == nil {
+				v.Other.Unknown = make(map[string]bencode.RawMessage)
+			}
+			v.Other.Unknown[string(key)] = append(bencode.RawMessage(nil), value...)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,107 @@
+// bencodegen generates MarshalBencode and UnmarshalBencode methods
+// for struct types, so that they are encoded and decoded without
+// reflection.
+//
+// Usage:
+//
+//	bencodegen -type T[,U...] [-output file] [dir]
+//
+// bencodegen loads the package in dir, the current directory by
+// default, and writes methods for the named types to the output
+// file, t_bencode.go by default, where t is the first type in lower
+// case. It is meant to be run by go generate, from a line such as
+//
+//	//go:generate bencodegen -type Torrent,File
+//
+// The methods follow the rules of Marshal and Unmarshal for struct
+// fields: tags, the "-" tag, the omitempty, rest, string and unixms
+// options, and the promotion of the fields of embedded structs. The
+// string and unixms options are not supported on pointer fields.
+// Fields of strings, integers, []byte, the generated types, and
+// slices and pointers of those are handled directly; other fields
+// are passed to Marshal and UnmarshalField.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var (
+	typeNames = flag.String("type", "", "comma-separated list of type names; required")
+	output    = flag.String("output", "", "output file name; default <type>_bencode.go")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: bencodegen -type T[,U...] [-output file] [dir]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *typeNames == "" || flag.NArg() > 1 {
+		usage()
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	names := strings.Split(*typeNames, ",")
+	out := *output
+	if out == "" {
+		out = filepath.Join(dir, strings.ToLower(names[0])+"_bencode.go")
+	}
+
+	pkg, err := loadPackage(dir, out)
+	if err != nil {
+		fatal(err)
+	}
+	src, err := generate(pkg, names, strings.Join(os.Args[1:], " "))
+	if err != nil {
+		fatal(err)
+	}
+	if err = ioutil.WriteFile(out, src, 0644); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "bencodegen:", err)
+	os.Exit(1)
+}
+
+// loadPackage parses and type-checks the package in dir,
+// leaving out the file out, which may be an earlier output.
+func loadPackage(dir, out string) (*types.Package, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range bp.GoFiles {
+		name = filepath.Join(dir, name)
+		if filepath.Clean(name) == filepath.Clean(out) {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(bp.Name, fset, files, nil)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestGolden checks that the methods of the gentest package,
+// which are tested against reflection, are up to date.
+func TestGolden(t *testing.T) {
+	const out = "gentest/types_bencode.go"
+	pkg, err := loadPackage("gentest", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := generate(pkg, strings.Split("Torrent,Info,File,Mixed", ","),
+		"-type Torrent,Info,File,Mixed -output types_bencode.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s is out of date; run go generate", out)
+	}
+
+	for _, name := range []string{"Kind", "Missing"} {
+		if _, err = generate(pkg, []string{name}, ""); err == nil {
+			t.Errorf("generated methods for %s", name)
+		}
+	}
+}
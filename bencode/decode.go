@@ -5,19 +5,47 @@ import (
 	"encoding"
 	"errors"
 	"io"
+	"math/big"
 	"reflect"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // A Decoder decodes bencoded data from a stream.
 type Decoder struct {
-	r    io.Reader
-	buf  []byte
-	d    decodeState
-	scan scanner
-	err  error
+	r       io.Reader
+	buf     []byte
+	d       decodeState
+	scan    scanner
+	err     error
+	scanned int64 // amount of data already scanned
+
+	tokenScan scanner  // scanner state of the Token stream
+	tokenKey  bool     // next token is a dictionary key
+	tokenKeys []String // last key of each open dictionary, in strict mode
+
+	opts DecoderOptions
+}
+
+// DecoderOptions limits the resources a Decoder may use, for decoding
+// untrusted input. A limit of zero means no limit. Exceeding a limit
+// stops the Decoder with a *LimitError.
+type DecoderOptions struct {
+	// MaxDepth is the deepest nesting of lists and dictionaries.
+	MaxDepth int
+
+	// MaxStringLength is the longest string or dictionary key.
+	MaxStringLength int
+
+	// MaxValueSize is the longest encoding of a value read by
+	// Decode. Token reads values piecewise, and does not check it.
+	MaxValueSize int64
+
+	// MaxElements is the largest number of elements
+	// in a list, or of entries in a dictionary.
+	MaxElements int
 }
 
 // NewDecoder returns a new decoder that decodes from r.
@@ -26,86 +54,217 @@ func NewDecoder(r io.Reader) *Decoder {
 }
 
 // Decode decodes data from the wrapped stream into v.
+//
+// Decode may be called between calls to Token to decode the
+// next list element or dictionary value in place.
 func (dec *Decoder) Decode(v interface{}) error {
+	if dec.tokenKey {
+		return errors.New("bencode: Decode called while expecting a dictionary key")
+	}
+
 	n, err := dec.readValue()
 	if err != nil {
 		return err
 	}
 
+	if dec.scan.strict {
+		err = checkValue(dec.buf[0:n], &dec.scan, true)
+		if se, ok := err.(*SyntaxError); ok {
+			se.Offset += dec.scanned
+		}
+	}
+
 	// Don't save err from unmarshal into dec.err:
 	// the connection is still usable since we read a complete bencode
 	// object from it before the error happened.
-	dec.d.init(dec.buf[0:n])
-	err = dec.d.unmarshal(v)
+	if err == nil {
+		dec.d.init(dec.buf[0:n])
+		err = dec.d.unmarshal(v, false)
+		// Make offsets relative to the stream.
+		switch e := err.(type) {
+		case *UnmarshalTypeError:
+			e.Offset += dec.scanned
+		case *FieldError:
+			e.Offset += dec.scanned
+		}
+	}
 
 	// Slide rest of data down.
-	rest := copy(dec.buf, dec.buf[n:])
-	dec.buf = dec.buf[0:rest]
+	dec.consume(n)
 
+	if len(dec.tokenScan.parseState) > 0 {
+		// The value was inside a list or dictionary
+		// opened by Token, so advance past it.
+		dec.tokenScan.step = stateEndValue
+		dec.tokenValueEnd()
+	}
 	return err
 }
 
-// Buffered returns a read of the data remaining in the Decoder's buffer.
-// The reader is valid until the next call to Decode.
+// Strict causes the Decoder to reject values that are not in the
+// canonical form required by BEP 3, as checked by ValidCanonical.
+func (dec *Decoder) Strict() {
+	dec.scan.strict = true
+	dec.tokenScan.strict = true
+}
+
+// DisallowUnknownFields causes the Decoder to return an error when
+// the destination is a struct and the input contains a dictionary
+// key that matches no field of the struct, unless the struct has a
+// field with the "rest" option to collect such keys. Unmarshalers,
+// such as those generated by bencodegen, do not see this setting.
+func (dec *Decoder) DisallowUnknownFields() {
+	dec.d.disallowUnknownFields = true
+}
+
+// UseNumber causes the Decoder to decode an integer
+// into an interface{} as a Number instead of as an int64.
+func (dec *Decoder) UseNumber() {
+	dec.d.useNumber = true
+}
+
+// UseBigInt causes the Decoder to decode an integer that does
+// not fit in an int64 into an interface{} as a *big.Int,
+// rather than to fail.
+func (dec *Decoder) UseBigInt() {
+	dec.d.useBigInt = true
+}
+
+// Borrow causes the Decoder to store byte strings decoded into
+// []byte, RawMessage and interface{} values as slices of its buffer
+// rather than as copies, saving an allocation for each. The Decoder
+// never writes over data it has decoded, so such a value remains
+// valid after later calls to Decode or Token, but it keeps the
+// memory of the buffer it refers to from being freed.
+func (dec *Decoder) Borrow() {
+	dec.d.borrow = true
+}
+
+// SetOptions sets the limits of the Decoder.
+func (dec *Decoder) SetOptions(opts DecoderOptions) {
+	dec.opts = opts
+	dec.scan.limits = &dec.opts
+	dec.tokenScan.limits = &dec.opts
+}
+
+// Buffered returns a reader of the data remaining in the Decoder's buffer.
+// The reader is valid until the next call to Decode or Token.
 func (dec *Decoder) Buffered() io.Reader {
 	return bytes.NewReader(dec.buf)
 }
 
+// Remainder returns a reader of the stream after the last value
+// decoded: the data remaining in the Decoder's buffer followed by
+// the rest of the underlying reader. Unlike Buffered, the bytes
+// read from it are consumed, so that decoding may resume after a
+// raw payload. Bytes read are counted by InputOffset.
+//
+// Remainder should not be read while a list or dictionary opened
+// by Token is incomplete.
+func (dec *Decoder) Remainder() io.Reader {
+	return remainder{dec}
+}
+
+type remainder struct{ dec *Decoder }
+
+func (r remainder) Read(p []byte) (int, error) {
+	dec := r.dec
+	if len(dec.buf) > 0 {
+		n := copy(p, dec.buf)
+		dec.consume(n)
+		return n, nil
+	}
+	if dec.err != nil {
+		return 0, dec.err
+	}
+	n, err := dec.r.Read(p)
+	dec.scanned += int64(n)
+	return n, err
+}
+
 // readValue reads a bencode value into dec.buf.
 // It returns the length of the encoding.
 func (dec *Decoder) readValue() (int, error) {
 	dec.scan.reset()
 
-	var scanp, op, n int
+	var scanp, op int
 	var err error
-Input:
 	for {
-		for scanp < len(dec.buf) {
+		for !dec.scan.endTop && scanp < len(dec.buf) {
+			dec.scan.bytes = dec.scanned + int64(scanp)
 			op = dec.scan.step(&dec.scan, int(dec.buf[scanp]))
 			scanp++
 			if op >= 0 {
-				dec.scan.bytes += int64(op)
+				// Skip a string, which may not be buffered yet.
 				scanp += op
-				if dec.scan.endTop {
-					break Input
-				}
-			} else {
-				dec.scan.bytes++
-				switch op {
-				case scanEnd:
-					break Input
-
-				case scanError:
-					dec.err = dec.scan.err
-					return 0, dec.scan.err
-				}
+			} else if op == scanError {
+				dec.err = dec.scan.err
+				return 0, dec.scan.err
 			}
+			if max := dec.opts.MaxValueSize; max > 0 && int64(scanp) > max {
+				dec.err = &LimitError{"MaxValueSize", dec.scanned + max}
+				return 0, dec.err
+			}
+		}
+
+		// The value ends with the closing 'e' of an integer,
+		// list or dictionary, or the last byte of a string.
+		if dec.scan.endTop && scanp <= len(dec.buf) {
+			return scanp, nil
 		}
 
 		// Did the last read have an error?
 		// Delayed until now to allow buffer scan.
 		if err != nil {
-			if err == io.EOF && dec.scan.endTop {
-				err = nil
-				break Input
+			if err == io.EOF && len(dec.buf) > 0 {
+				err = io.ErrUnexpectedEOF
 			}
 			dec.err = err
 			return 0, err
 		}
 
-		// Make room to read more into the buffer.
-		const minRead = 512
-		if cap(dec.buf)-len(dec.buf) < minRead {
-			newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
-			copy(newBuf, dec.buf)
-			dec.buf = newBuf
+		// Read. Delay error for the next interation (after scan).
+		err = dec.refill()
+	}
+}
+
+// refill reads more data into dec.buf, growing it if necessary.
+func (dec *Decoder) refill() error {
+	// Make room to read more into the buffer.
+	const minRead = 512
+	if cap(dec.buf)-len(dec.buf) < minRead {
+		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
+		copy(newBuf, dec.buf)
+		dec.buf = newBuf
+	}
+
+	n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
+	dec.buf = dec.buf[0 : len(dec.buf)+n]
+	return err
+}
+
+// peek returns the byte at offset i of dec.buf, reading more data as needed.
+func (dec *Decoder) peek(i int) (byte, error) {
+	var err error
+	for len(dec.buf) <= i {
+		if err != nil {
+			return 0, err
 		}
+		err = dec.refill()
+	}
+	return dec.buf[i], nil
+}
 
-		// Read. Delay error for the next interation (after scan).
-		n, err = dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
-		dec.buf = dec.buf[0 : len(dec.buf)+n]
+// consume discards the first n bytes of dec.buf.
+func (dec *Decoder) consume(n int) {
+	dec.scanned += int64(n)
+	if dec.d.borrow {
+		// Decoded values may refer to the discarded bytes.
+		dec.buf = dec.buf[n:]
+		return
 	}
-	return scanp, nil
+	rest := copy(dec.buf, dec.buf[n:])
+	dec.buf = dec.buf[0:rest]
 }
 
 // An InvalidUnmarshalError describes an invalid argument passed to Unmarshal.
@@ -125,7 +284,9 @@ func (e *InvalidUnmarshalError) Error() string {
 	return "bencode: Unmarshal(nil " + e.Type.String() + ")"
 }
 
-func (d *decodeState) unmarshal(v interface{}) (err error) {
+// unmarshal decodes into the value v points to, as a top-level
+// value, or if field is set, as a struct field or list element.
+func (d *decodeState) unmarshal(v interface{}, field bool) (err error) {
 	defer func() {
 		if r := recover(); r != nil {
 			if _, ok := r.(runtime.Error); ok {
@@ -141,6 +302,10 @@ func (d *decodeState) unmarshal(v interface{}) (err error) {
 	}
 
 	d.scan.reset()
+	if field {
+		d.value(rv.Elem())
+		return d.savedError
+	}
 	// We decode rv not rv.Elem because the Unmarshaler interface
 	// test must be applied at the top level of the value.
 	d.value(rv)
@@ -150,12 +315,104 @@ func (d *decodeState) unmarshal(v interface{}) (err error) {
 // An UnmarshalTypeError describes a bencode value that was
 // not appropriate for a value of a specific Go type.
 type UnmarshalTypeError struct {
-	Value string       // description of bencode value
-	Type  reflect.Type // type of Go value it could not be assigned to
+	Value  string       // description of bencode value
+	Type   reflect.Type // type of Go value it could not be assigned to
+	Offset int64        // offset of the value in the input
+	Field  string       // path to the value, such as info.files[12].length
 }
 
 func (e *UnmarshalTypeError) Error() string {
-	return "bencode: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	s := "bencode: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	if e.Field != "" {
+		s += " at " + e.Field
+	}
+	return s
+}
+
+// A FieldError is an error in decoding or encoding
+// the value at a path within a list or dictionary.
+type FieldError struct {
+	// Path is the path to the value, such as info.files[12].length.
+	// Dictionary keys, struct fields and map keys are separated by
+	// dots, and list and slice indexes are in brackets. Decoding
+	// names dictionary keys, and encoding names Go struct fields.
+	Path string
+
+	// Offset is the offset of the value in the input when
+	// decoding, or in the output written so far when encoding.
+	Offset int64
+
+	Err error // the cause
+}
+
+func (e *FieldError) Error() string {
+	return "bencode: " + e.Path + ": " + strings.TrimPrefix(e.Err.Error(), "bencode: ")
+}
+
+// Unwrap returns the cause of e.
+func (e *FieldError) Unwrap() error { return e.Err }
+
+// A pathElem is a dictionary key or list index on the
+// path to a value, which starts at offset off.
+type pathElem struct {
+	key   string
+	index int // -1 for a key
+	off   int
+}
+
+// formatPath returns path as a string, such as info.files[12].length.
+func formatPath(path []pathElem) string {
+	var b []byte
+	for _, e := range path {
+		if e.index >= 0 {
+			b = append(b, '[')
+			b = strconv.AppendInt(b, int64(e.index), 10)
+			b = append(b, ']')
+			continue
+		}
+		if len(b) > 0 {
+			b = append(b, '.')
+		}
+		b = append(b, e.key...)
+	}
+	return string(b)
+}
+
+// joinPath returns the path elem within the value at path.
+func joinPath(path, elem string) string {
+	if path == "" || elem == "" {
+		return path + elem
+	}
+	if elem[0] == '[' {
+		return path + elem
+	}
+	return path + "." + elem
+}
+
+// atPath returns err as an error in the value at path, which starts
+// at offset off. The path and offset of an *UnmarshalTypeError or a
+// *FieldError are taken to be within that value. Other errors with
+// a path are wrapped in a *FieldError. Syntax and limit errors carry
+// their own offsets, and are returned as they are.
+func atPath(err error, path string, off int64) error {
+	switch e := err.(type) {
+	case *SyntaxError, *LimitError:
+		return err
+	case *UnmarshalTypeError:
+		ne := *e
+		ne.Field = joinPath(path, e.Field)
+		ne.Offset += off
+		return &ne
+	case *FieldError:
+		ne := *e
+		ne.Path = joinPath(path, e.Path)
+		ne.Offset += off
+		return &ne
+	}
+	if path == "" {
+		return err
+	}
+	return &FieldError{Path: path, Offset: off, Err: err}
 }
 
 type decodeState struct {
@@ -163,6 +420,12 @@ type decodeState struct {
 	off        int // read offset in data
 	scan       scanner
 	savedError error
+	path       []pathElem // keys and indexes on the way to the value at off
+
+	disallowUnknownFields bool
+	useNumber             bool
+	useBigInt             bool
+	borrow                bool // see Decoder.Borrow
 }
 
 // errPhase is used for errors that should not happen unless
@@ -174,12 +437,46 @@ func (d *decodeState) init(data []byte) *decodeState {
 	d.data = data
 	d.off = 0
 	d.savedError = nil
+	d.path = d.path[:0]
 	return d
 }
 
+// saveError saves the first err it is called with,
+// for reporting at the end of the unmarshal.
+func (d *decodeState) saveError(err error) {
+	if d.savedError == nil {
+		d.savedError = d.addContext(err)
+	}
+}
+
 // error aborts the decoding by panicking with err.
 func (d *decodeState) error(err error) {
-	panic(err)
+	panic(d.addContext(err))
+}
+
+// addContext returns err with the path and offset
+// of the value being decoded.
+func (d *decodeState) addContext(err error) error {
+	n := len(d.path)
+	if n == 0 {
+		return atPath(err, "", 0)
+	}
+	return atPath(err, formatPath(d.path), int64(d.path[n-1].off))
+}
+
+// pushKey and pushIndex add the dictionary key or list index
+// of the value that starts at d.off to the path, and popPath
+// removes it.
+func (d *decodeState) pushKey(key string) {
+	d.path = append(d.path, pathElem{key, -1, d.off})
+}
+
+func (d *decodeState) pushIndex(i int) {
+	d.path = append(d.path, pathElem{"", i, d.off})
+}
+
+func (d *decodeState) popPath() {
+	d.path = d.path[:len(d.path)-1]
 }
 
 // skip reads d.data with a fresh scanner, skimming over the next value
@@ -225,6 +522,10 @@ func (d *decodeState) value(v reflect.Value) {
 		d.unmarshaler(v)
 		return
 	}
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		d.unmarshaler(v.Addr())
+		return
+	}
 
 	op := d.scan.step(&d.scan, int(d.data[d.off]))
 	d.off++
@@ -261,7 +562,7 @@ func (d *decodeState) valueInterface() (x interface{}) {
 	switch d.scan.step(&d.scan, c) {
 
 	case scanBeginStringLen:
-		x = d.readString()
+		x = d.stringBytes()
 
 	case scanBeginInteger:
 		x = d.integerInterface()
@@ -310,6 +611,9 @@ Read:
 // integer consumes an integer from d.data[d.off:], decoding into the value v.
 func (d *decodeState) integer(v reflect.Value) {
 	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
 		v = v.Elem()
 	}
 
@@ -321,6 +625,23 @@ func (d *decodeState) integer(v reflect.Value) {
 
 	s := string(d.readInteger())
 
+	if v.Type() == bigIntType {
+		z, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			d.error(&UnmarshalTypeError{Value: "integer " + s, Type: v.Type()})
+		}
+		v.Addr().Interface().(*big.Int).Set(z)
+		return
+	}
+	if v.Type() == timeType {
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			d.error(err)
+		}
+		v.Set(reflect.ValueOf(time.Unix(n, 0)))
+		return
+	}
+
 	switch k {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		n, err := strconv.ParseInt(s, 10, 64)
@@ -339,7 +660,7 @@ func (d *decodeState) integer(v reflect.Value) {
 	case reflect.Float32, reflect.Float64:
 		n, err := strconv.ParseFloat(s, v.Type().Bits())
 		if err != nil || v.OverflowFloat(n) {
-			d.error(&UnmarshalTypeError{"integer " + s, v.Type()})
+			d.error(&UnmarshalTypeError{Value: "integer " + s, Type: v.Type()})
 		}
 		v.SetFloat(n)
 
@@ -354,16 +675,24 @@ func (d *decodeState) integer(v reflect.Value) {
 		v.SetBool(n != 0)
 
 	default:
-		d.error(&UnmarshalTypeError{"integer " + s, v.Type()})
+		d.error(&UnmarshalTypeError{Value: "integer " + s, Type: v.Type()})
 	}
 }
 
 // intergerInterface consumes an integer from d.data[d.off:], and returns an interface{}.
 func (d *decodeState) integerInterface() (x interface{}) {
 	s := string(d.readInteger())
+	if d.useNumber {
+		return Number(s)
+	}
 
 	n, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
+		if d.useBigInt {
+			if z, ok := new(big.Int).SetString(s, 10); ok {
+				return z
+			}
+		}
 		d.error(err)
 	}
 	return n
@@ -394,6 +723,18 @@ Read:
 	return d.data[i:d.off]
 }
 
+// stringBytes is like readString but returns a copy, as the
+// Decoder reuses the memory of d.data, unless d.borrow is set.
+func (d *decodeState) stringBytes() []byte {
+	b := d.readString()
+	if d.borrow {
+		// Limit the capacity so that appending to b
+		// does not write over the rest of d.data.
+		return b[:len(b):len(b)]
+	}
+	return append(make([]byte, 0, len(b)), b...)
+}
+
 // string consumes a string from d.data[d.off:], decoding into the value v.
 func (d *decodeState) string(v reflect.Value) {
 	for {
@@ -418,24 +759,24 @@ func (d *decodeState) string(v reflect.Value) {
 
 	switch v.Kind() {
 	default:
-		d.error(&UnmarshalTypeError{"string", v.Type()})
+		d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
 
 	case reflect.Slice:
 		if v.Type() != byteSliceType {
-			d.error(&UnmarshalTypeError{"string", v.Type()})
+			d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
 		}
 
-		v.SetBytes(d.readString())
+		v.SetBytes(d.stringBytes())
 
 	case reflect.String:
 		v.SetString(string(d.readString()))
 
 	case reflect.Interface:
 		if v.NumMethod() != 0 {
-			d.error(&UnmarshalTypeError{"string", v.Type()})
+			d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
 		}
 
-		x := d.readString()
+		x := d.stringBytes()
 		v.Set(reflect.ValueOf(x))
 	}
 }
@@ -458,23 +799,25 @@ func (d *decodeState) list(v reflect.Value) {
 		// Otherwilse it's invalid
 		fallthrough
 	default:
-		d.error(&UnmarshalTypeError{"list", v.Type()})
+		d.error(&UnmarshalTypeError{Value: "list", Type: v.Type()})
 
 	case reflect.Array:
 	case reflect.Slice:
 	}
 
-	var c, op int
 	i := v.Len()
-Read:
+	start := i
 	for {
-		c = int(d.data[d.off])
-		d.off++
-		op = d.scan.step(&d.scan, c)
-
-		switch op {
-		case scanEndList, scanEnd:
-			break Read
+		if d.data[d.off] == 'e' {
+			switch d.scan.step(&d.scan, 'e') {
+			case scanEndList, scanEnd:
+			case scanError:
+				d.error(d.scan.err)
+			default:
+				d.error(errPhase)
+			}
+			d.off++
+			break
 		}
 
 		// Get element of array, growing if necessary.
@@ -503,31 +846,19 @@ Read:
 			subv = reflect.Value{}
 		}
 
-		for subv.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		for subv.Kind() == reflect.Ptr {
 			if subv.IsNil() {
 				subv.Set(reflect.New(subv.Type().Elem()))
 			}
 			subv = subv.Elem()
 		}
-		switch op {
-		case scanBeginStringLen:
-			d.string(subv)
-
-		case scanBeginInteger:
-			d.integer(subv)
 
-		case scanBeginList:
-			d.list(subv)
-
-		case scanBeginDict:
-			d.dict(subv)
-
-		case scanError:
-			d.error(d.scan.err)
-		default:
-			d.error(errPhase)
-
-		}
+		// The element is not an 'e', so the scanner
+		// would begin a value with it.
+		d.scan.step = stateBeginValue
+		d.pushIndex(i - start)
+		d.value(subv)
+		d.popPath()
 		i++
 	}
 
@@ -556,15 +887,17 @@ func (d *decodeState) listInterface() interface{} {
 	)
 Read:
 	for {
+		d.pushIndex(len(v))
 		c = int(d.data[d.off])
 		d.off++
 
 		switch op := d.scan.step(&d.scan, c); op {
-		case scanEndList:
+		case scanEndList, scanEnd:
+			d.popPath()
 			break Read
 
 		case scanBeginStringLen:
-			x = d.readString()
+			x = d.stringBytes()
 		case scanBeginInteger:
 			x = d.integerInterface()
 		case scanBeginList:
@@ -577,6 +910,7 @@ Read:
 		default:
 			d.error(errPhase)
 		}
+		d.popPath()
 		v = append(v, x)
 	}
 	return v
@@ -586,7 +920,7 @@ Read:
 func (d *decodeState) dict(v reflect.Value) {
 	for v.Kind() == reflect.Ptr {
 		if v.IsNil() {
-			return
+			v.Set(reflect.New(v.Type().Elem()))
 		}
 		v = v.Elem()
 	}
@@ -600,10 +934,9 @@ func (d *decodeState) dict(v reflect.Value) {
 	// Check type of target: struct or map[string]interface{}
 	switch v.Kind() {
 	case reflect.Map:
-		// map must have string kind
 		t := v.Type()
-		if t.Key().Kind() != reflect.String {
-			d.error(&UnmarshalTypeError{"dictionary", v.Type()})
+		if !isMapKeyType(t.Key(), true) {
+			d.error(&UnmarshalTypeError{Value: "dictionary", Type: v.Type()})
 		}
 		if v.IsNil() {
 			v.Set(reflect.MakeMap(t))
@@ -612,10 +945,10 @@ func (d *decodeState) dict(v reflect.Value) {
 	case reflect.Struct:
 
 	default:
-		d.error(&UnmarshalTypeError{"dictionary", v.Type()})
+		d.error(&UnmarshalTypeError{Value: "dictionary", Type: v.Type()})
 	}
 
-	var mapElem reflect.Value
+	var mapElem, restMap reflect.Value
 	var key string
 	var c, op, p int
 Read:
@@ -626,7 +959,7 @@ Read:
 			c = int(d.data[d.off])
 			d.off++
 			op = d.scan.step(&d.scan, c)
-			if op > 0 {
+			if op >= 0 {
 				p = d.off
 				d.off += op
 				break ReadKey
@@ -646,6 +979,8 @@ Read:
 
 		// Figure out field corresponding to key.
 		var subv reflect.Value
+		var quoted, unixMilli bool
+		var fieldErr error
 
 		if v.Kind() == reflect.Map {
 			elemType := v.Type().Elem()
@@ -657,7 +992,7 @@ Read:
 			subv = mapElem
 		} else {
 			var f *field
-			fields := cachedTypeFields(v.Type())
+			fields, rest := splitRest(cachedTypeFields(v.Type()))
 			for i := range fields {
 				ff := &fields[i]
 				if ff.name == key {
@@ -668,32 +1003,163 @@ Read:
 					f = ff
 				}
 			}
-			if f != nil {
-				subv = v
-				for _, i := range f.index {
-					if subv.Kind() == reflect.Ptr {
-						if subv.IsNil() {
-							subv.Set(reflect.New(subv.Type().Elem()))
-						}
-						subv = subv.Elem()
-					}
-					subv = subv.Field(i)
+			switch {
+			case f != nil:
+				if subv, fieldErr = fieldByIndexAlloc(v, f.index); fieldErr != nil {
+					break
 				}
+				quoted, unixMilli = f.quoted, f.unixMilli
+			case rest != nil:
+				if restMap, fieldErr = fieldByIndexAlloc(v, rest.index); fieldErr != nil {
+					break
+				}
+				if restMap.IsNil() {
+					restMap.Set(reflect.MakeMap(restType))
+				}
+				subv = reflect.New(restType.Elem()).Elem()
+			case d.disallowUnknownFields:
+				d.saveError(errors.New("bencode: unknown field " + strconv.Quote(key)))
 			}
 		}
 
-		// Read value.
-		d.value(subv)
+		// Read value, or skip it if its field cannot be reached.
+		d.pushKey(key)
+		if fieldErr != nil {
+			d.saveError(fieldErr)
+		}
+		switch {
+		case quoted:
+			d.quotedValue(subv)
+		case unixMilli:
+			d.unixMilli(subv)
+		default:
+			d.value(subv)
+		}
 
 		// Write value back to map;
 		// if using struct, subv points into struct already.
 		if v.Kind() == reflect.Map {
-			kv := reflect.ValueOf(key).Convert(v.Type().Key())
-			v.SetMapIndex(kv, subv)
+			v.SetMapIndex(d.mapKey(key, v.Type().Key()), subv)
+		} else if restMap.IsValid() {
+			restMap.SetMapIndex(reflect.ValueOf(key), subv)
+			restMap = reflect.Value{}
 		}
+		d.popPath()
 	}
 }
 
+// mapKey returns the map key of type t of the dictionary key key.
+func (d *decodeState) mapKey(key string, t reflect.Type) reflect.Value {
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(key).Convert(t)
+	}
+	kv := reflect.New(t)
+	if u, ok := kv.Interface().(encoding.TextUnmarshaler); ok {
+		if err := u.UnmarshalText([]byte(key)); err != nil {
+			d.error(err)
+		}
+		return kv.Elem()
+	}
+	kv = kv.Elem()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || kv.OverflowInt(n) {
+			d.error(&UnmarshalTypeError{Value: "dictionary key " + strconv.Quote(key), Type: t})
+		}
+		kv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || kv.OverflowUint(n) {
+			d.error(&UnmarshalTypeError{Value: "dictionary key " + strconv.Quote(key), Type: t})
+		}
+		kv.SetUint(n)
+	default:
+		// A byte array, which the key must fill.
+		if len(key) != kv.Len() {
+			d.error(&UnmarshalTypeError{Value: "dictionary key " + strconv.Quote(key), Type: t})
+		}
+		for i := 0; i < len(key); i++ {
+			kv.Index(i).SetUint(uint64(key[i]))
+		}
+	}
+	return kv
+}
+
+// quotedValue decodes a decimal string into the number v, for a
+// field with the "string" option. Integers are decoded as usual.
+func (d *decodeState) quotedValue(v reflect.Value) {
+	if c := d.data[d.off]; c < '0' || c > '9' {
+		d.value(v)
+		return
+	}
+	switch d.scan.step(&d.scan, int(d.data[d.off])) {
+	case scanBeginStringLen:
+	case scanError:
+		d.error(d.scan.err)
+	default:
+		d.error(errPhase)
+	}
+	d.off++
+	s := string(d.readString())
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v.OverflowInt(n) {
+			d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || v.OverflowUint(n) {
+			d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
+		}
+		v.SetUint(n)
+	default:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			d.error(&UnmarshalTypeError{Value: "string", Type: v.Type()})
+		}
+		v.SetFloat(n)
+	}
+}
+
+// unixMilli decodes an integer of Unix milliseconds into the time v,
+// for a field with the "unixms" option. Strings are decoded as usual.
+func (d *decodeState) unixMilli(v reflect.Value) {
+	if d.data[d.off] != 'i' {
+		d.value(v)
+		return
+	}
+	switch d.scan.step(&d.scan, int(d.data[d.off])) {
+	case scanBeginInteger:
+	case scanError:
+		d.error(d.scan.err)
+	default:
+		d.error(errPhase)
+	}
+	d.off++
+	n, err := strconv.ParseInt(string(d.readInteger()), 10, 64)
+	if err != nil {
+		d.error(err)
+	}
+
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	v.Set(reflect.ValueOf(time.Unix(n/1000, n%1000*1e6)))
+}
+
 // dictInterface is like dict but returns a map[string]interface{}.
 func (d *decodeState) dictInterface() map[string]interface{} {
 	m := make(map[string]interface{})
@@ -706,13 +1172,13 @@ Read:
 			c = int(d.data[d.off])
 			d.off++
 			op = d.scan.step(&d.scan, c)
-			if op > 0 {
+			if op >= 0 {
 				p = d.off
 				d.off += op
 				break ReadKey
 			} else {
 				switch op {
-				case scanEndDict:
+				case scanEndDict, scanEnd:
 					break Read
 				case scanBeginKeyLen, scanParseKeyLen, scanParseKey:
 				case scanEndKeyLen:
@@ -723,7 +1189,9 @@ Read:
 			}
 		}
 		key = string(d.data[p:d.off])
+		d.pushKey(key)
 		m[key] = d.valueInterface()
+		d.popPath()
 	}
 	return m
 }
@@ -750,8 +1218,11 @@ ReadRaw:
 		}
 
 		op = tmpScan.step(&tmpScan, int(d.data[d.off]))
-		if op > 0 {
+		if op >= 0 {
 			d.off += op + 1
+			if tmpScan.endTop {
+				break ReadRaw
+			}
 		} else {
 			d.off++
 			switch op {
@@ -763,6 +1234,10 @@ ReadRaw:
 		}
 	}
 
+	if m, ok := u.(*RawMessage); ok && d.borrow {
+		*m = d.data[start:d.off:d.off]
+		return
+	}
 	if err := u.UnmarshalBencode(d.data[start:d.off]); err != nil {
 		d.error(err)
 	}
@@ -778,18 +1253,69 @@ ReadRaw:
 // To unmarshal bencode into a struct, Unmarshal matches incoming
 // dictionaries to the keys used by Marshal (either the struct field
 // name or its tag), preferring an exact match but also accepting a
-// case-insensitive match.
+// case-insensitive match. Keys that match no field are ignored,
+// or stored in the field tagged with the "rest" option, if the
+// struct has one.
+//
+// To unmarshal a dictionary into a map, Unmarshal decodes its keys as
+// Marshal encodes the keys of the map type.
 //
 // To unmarshal bencode into an interface value, Unmarshal unmarshals
 // data into the concrete value contained in the interface value. If
 // the interface value is nil, that is, has no concrete value stored in it,
 // Unmarshal stores one of these in the interface value:
 //
-// int64, for integers
+// int64, for integers (but see Decoder.UseNumber and Decoder.UseBigInt)
 // []byte, for a byte string
 // []interface{} for a list
 // map[string]interface{} for a dictionary
 //
+// Byte strings stored in []byte and RawMessage values are copies,
+// which remain valid if data is modified. UnmarshalBorrow avoids
+// the copies.
+//
 func Unmarshal(data []byte, v interface{}) error {
 	return NewDecoder(bytes.NewReader(data)).Decode(v)
 }
+
+// UnmarshalBorrow is like Unmarshal, but byte strings decoded into
+// []byte, RawMessage and interface{} values are slices of data
+// rather than copies, as with Decoder.Borrow. Those values change
+// if data is modified, so data must not be modified, or reused,
+// while they are in use.
+func UnmarshalBorrow(data []byte, v interface{}) error {
+	// Decode from data itself; a Decoder that borrows never
+	// writes to its buffer, and a full one is copied to grow.
+	dec := &Decoder{r: new(bytes.Reader), buf: data[:len(data):len(data)]}
+	dec.Borrow()
+	return dec.Decode(v)
+}
+
+// UnmarshalField is like Unmarshal, but decodes data as Unmarshal
+// decodes a struct field or list element of the type v points to.
+// The difference is that a TextUnmarshaler method with a pointer
+// receiver is only used for a top-level value. Unmarshalers
+// generated by bencodegen use UnmarshalField to decode fields.
+func UnmarshalField(data []byte, v interface{}) error {
+	var d decodeState
+	if err := checkValue(data, &d.scan, false); err != nil {
+		return err
+	}
+	d.init(data)
+	return d.unmarshal(v, true)
+}
+
+// UnmarshalPrefix is like Unmarshal but decodes only the first
+// value of data, returning the bytes that follow it. It suits
+// messages that carry a binary payload after a bencoded value.
+// If the value is well formed but cannot be stored in v, rest
+// is returned along with the error. It is SplitValue followed
+// by Unmarshal of the value; use SplitValue to keep the value
+// undecoded, such as to pass it on or to decode it later.
+func UnmarshalPrefix(data []byte, v interface{}) (rest []byte, err error) {
+	value, rest, err := SplitValue(data)
+	if err != nil {
+		return nil, err
+	}
+	return rest, Unmarshal(value, v)
+}
@@ -5,9 +5,12 @@ import (
 	"encoding"
 	"fmt"
 	"io"
+	"math/big"
 	"reflect"
 	"runtime"
 	"sort"
+	"strconv"
+	"time"
 )
 
 // Encoder writes bencode data to an output stream..
@@ -15,6 +18,8 @@ type Encoder struct {
 	w   io.Writer
 	e   encodeState
 	err error
+
+	levels []encLevel // lists and dictionaries left open by Begin methods
 }
 
 // NewEncoder returns a new Encoder that bencodes to w.
@@ -26,6 +31,10 @@ func NewEncoder(w io.Writer) *Encoder {
 //
 // See the documentation for Marshal for details about the
 // conversion of Go values to bencode.
+//
+// Encode may be called inside a list or dictionary started by
+// BeginList or BeginDict to write an element or the value of
+// an entry.
 func (enc *Encoder) Encode(v interface{}) error {
 	if enc.err != nil {
 		return enc.err
@@ -36,10 +45,10 @@ func (enc *Encoder) Encode(v interface{}) error {
 		return err
 	}
 
-	if _, err = enc.w.Write(enc.e.Bytes()); err != nil {
-		enc.err = err
+	if err = enc.beginValue(); err != nil {
+		return err
 	}
-	return err
+	return enc.write(enc.e.Bytes())
 }
 
 // Marshal returns a bencoded form of x.
@@ -47,16 +56,24 @@ func (enc *Encoder) Encode(v interface{}) error {
 // Marshal traverses the value v recursively using the the following
 // type-dependent encodings:
 //
-// Integer types encode as bencode integers.
+// Integer types encode as bencode integers,
+// as do big.Int values and Numbers.
+//
+// Boolean values encode as the integers 1 and 0.
+//
+// time.Time values encode as integers of Unix seconds.
 //
 // String and []byte values encode as bencode strings.
 //
+// Floating point values cannot be encoded, except as struct
+// fields with the "string" option, described below.
+//
 // Struct values encode as bencode dictionaries. Each exported struct
 // field becomes a member of the object unless
 //   - the field's tag is "-", or
 //   - the field is empty and its tag specifies the "omitempty" option.
 // The empty values are false, 0, any nil pointer or interface value,
-// and any array, slice, string, or map with zero length.
+// any array, slice, string, or map with zero length, and the zero time.
 // The values default key string is the struct field name but can be
 // specified in the struct field's tag value. The "bencode" key in the
 // struct field's tag value is the key name, followed by an optional
@@ -77,6 +94,17 @@ func (enc *Encoder) Encode(v interface{}) error {
 // // but the field is skipped if empty.
 // // Note the leading comma.
 // Field int `bencode:",omitempty"`
+//
+// // Field holds the keys that match no other field, which
+// // Unmarshal stores in it and Marshal merges back in.
+// Field map[string]RawMessage `bencode:",rest"`
+//
+// // Field appears in bencode dictionaries as a decimal string,
+// // such as "3:1.5". It suits integer and floating point fields.
+// Field float64 `bencode:",string"`
+//
+// // Field appears in bencode dictionaries as Unix milliseconds.
+// Field time.Time `bencode:",unixms"`
 // The key name will be used if it's a non-empty string consisting of
 // only Unicode letters, digits, dollar signs, percent signs, hyphens,
 // underscores and slashes.
@@ -103,9 +131,11 @@ func (enc *Encoder) Encode(v interface{}) error {
 // an anonymous struct field in both current and earlier versions, give the field
 // a bencode tag of "-".
 //
-// Map values encode as bencode objects.
-// The map's key type must be string; the object keys are used directly
-// as map keys.
+// Map values encode as bencode dictionaries. The map's key type must
+// be a string, integer or byte array type, or implement
+// encoding.TextMarshaler. Strings and byte arrays are used directly as
+// dictionary keys, integers in decimal, and other keys as their text.
+// The keys are sorted by their encoding.
 //
 // Pointer values encode as the value pointed to.
 // A nil pointer encodes as the null bencode object.
@@ -152,6 +182,7 @@ func (e *UnsupportedValueError) Error() string {
 type encodeState struct {
 	bytes.Buffer // accumulated output
 	scratch      [64]byte
+	path         []pathElem // fields, keys and indexes on the way to the value being encoded
 }
 
 func (e *encodeState) marshal(v interface{}) (err error) {
@@ -163,15 +194,24 @@ func (e *encodeState) marshal(v interface{}) (err error) {
 			err = r.(error)
 		}
 	}()
+	e.path = e.path[:0]
 	e.reflectValue(reflect.ValueOf(v))
 	return nil
 }
 
+// error aborts the encoding by panicking with err,
+// with the path and offset of the value being encoded.
 func (e *encodeState) error(err error) {
+	if n := len(e.path); n > 0 {
+		err = atPath(err, formatPath(e.path), int64(e.path[n-1].off))
+	}
 	panic(err)
 }
 
-var byteSliceType = reflect.TypeOf([]byte(nil))
+var (
+	byteSliceType = reflect.TypeOf([]byte(nil))
+	timeType      = reflect.TypeOf(time.Time{})
+)
 
 func isEmptyValue(v reflect.Value) bool {
 	switch v.Kind() {
@@ -187,6 +227,10 @@ func isEmptyValue(v reflect.Value) bool {
 		return v.Float() == 0
 	case reflect.Interface, reflect.Ptr:
 		return v.IsNil()
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return v.Interface().(time.Time).IsZero()
+		}
 	}
 	return false
 }
@@ -204,7 +248,10 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 	}
 
 	if v.Type().Implements(marshalerType) {
-
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			e.Write([]byte{'0', ':'})
+			return
+		}
 		m := v.Interface().(Marshaler)
 		b, err := m.MarshalBencode()
 		if err == nil {
@@ -216,6 +263,29 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 		return
 	}
 
+	if v.Type() == bigIntPtrType {
+		// Encode a big.Int as an integer, not as text.
+		if v.IsNil() {
+			e.Write([]byte{'0', ':'})
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Type() == bigIntType {
+		x := v.Interface().(big.Int)
+		e.WriteByte('i')
+		e.Write(x.Append(e.scratch[:0], 10))
+		e.WriteByte('e')
+		return
+	}
+
+	if v.Type() == timeType {
+		// Encode a time as Unix seconds, not as text.
+		t := v.Interface().(time.Time)
+		e.Write(AppendInt(e.scratch[:0], t.Unix()))
+		return
+	}
+
 	if v.Type().Implements(textMarshalerType) {
 		m := v.Interface().(encoding.TextMarshaler)
 		b, err := m.MarshalText()
@@ -231,6 +301,13 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 	}
 
 	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.WriteString("i1e")
+		} else {
+			e.WriteString("i0e")
+		}
+
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		fmt.Fprintf(e, "i%de", v.Int())
 
@@ -242,28 +319,68 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 		fmt.Fprintf(e, "%d:%s", len(s), s)
 
 	case reflect.Struct:
+		fields, rest := splitRest(cachedTypeFields(v.Type()))
+		var m map[string]RawMessage
+		var keys []string
+		if rest != nil {
+			if rv := fieldByIndex(v, rest.index); rv.IsValid() {
+				m = rv.Interface().(map[string]RawMessage)
+				keys = make([]string, 0, len(m))
+				for k := range m {
+					keys = append(keys, k)
+				}
+				sort.Strings(keys)
+			}
+		}
 		e.WriteByte('d')
-		for _, f := range cachedTypeFields(v.Type()) {
+		for _, f := range fields {
+			// Merge in the keys of rest that sort before f,
+			// leaving out any that f itself encodes.
+			for len(keys) > 0 && keys[0] <= f.name {
+				if keys[0] < f.name {
+					fmt.Fprintf(e, "%d:%s", len(keys[0]), keys[0])
+					e.reflectValue(reflect.ValueOf(m[keys[0]]))
+				}
+				keys = keys[1:]
+			}
 			fv := fieldByIndex(v, f.index)
 			if !fv.IsValid() || f.omitEmpty && isEmptyValue(fv) {
 				continue
 			}
 			fmt.Fprintf(e, "%d:%s", len(f.name), f.name)
-			e.reflectValue(fv)
+			e.path = append(e.path, pathElem{f.goName, -1, e.Len()})
+			switch {
+			case f.quoted:
+				e.quotedValue(fv)
+			case f.unixMilli:
+				e.unixMilli(fv)
+			default:
+				e.reflectValue(fv)
+			}
+			e.path = e.path[:len(e.path)-1]
+		}
+		for _, k := range keys {
+			fmt.Fprintf(e, "%d:%s", len(k), k)
+			e.reflectValue(reflect.ValueOf(m[k]))
 		}
 		e.WriteByte('e')
 
 	case reflect.Map:
-		if v.Type().Key().Kind() != reflect.String {
+		if !isMapKeyType(v.Type().Key(), false) {
 			e.error(&UnsupportedTypeError{v.Type()})
 		}
 		e.WriteByte('d')
 		if !v.IsNil() {
-			var keys stringValues = v.MapKeys()
+			keys := make(byKey, v.Len())
+			for i, k := range v.MapKeys() {
+				keys[i] = mapKey{e.mapKey(k), k}
+			}
 			sort.Sort(keys)
 			for _, k := range keys {
-				fmt.Fprintf(e, "%d:%s", k.Len(), k)
-				e.reflectValue(v.MapIndex(k))
+				fmt.Fprintf(e, "%d:%s", len(k.s), k.s)
+				e.path = append(e.path, pathElem{k.s, -1, e.Len()})
+				e.reflectValue(v.MapIndex(k.v))
+				e.path = e.path[:len(e.path)-1]
 			}
 		}
 		e.WriteByte('e')
@@ -280,7 +397,9 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 		e.WriteByte('l')
 		n := v.Len()
 		for i := 0; i < n; i++ {
+			e.path = append(e.path, pathElem{"", i, e.Len()})
 			e.reflectValue(v.Index(i))
+			e.path = e.path[:len(e.path)-1]
 		}
 		e.WriteByte('e')
 
@@ -291,3 +410,66 @@ func (e *encodeState) reflectValue(v reflect.Value) {
 		e.error(&UnsupportedTypeError{v.Type()})
 	}
 }
+
+// mapKey returns the encoding of the map key k as a dictionary key.
+func (e *encodeState) mapKey(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if k.Type().Implements(textMarshalerType) {
+		b, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			e.error(err)
+		}
+		return string(b)
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10)
+	}
+	// A byte array, whose element type may be named,
+	// so that reflect.Copy does not apply.
+	b := make([]byte, k.Len())
+	for i := range b {
+		b[i] = byte(k.Index(i).Uint())
+	}
+	return string(b)
+}
+
+// quotedValue writes the number in v as a decimal string,
+// for a field with the "string" option.
+func (e *encodeState) quotedValue(v reflect.Value) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.WriteString("0:")
+			return
+		}
+		v = v.Elem()
+	}
+	var b []byte
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		b = strconv.AppendInt(e.scratch[:0], v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		b = strconv.AppendUint(e.scratch[:0], v.Uint(), 10)
+	default:
+		b = strconv.AppendFloat(e.scratch[:0], v.Float(), 'g', -1, v.Type().Bits())
+	}
+	fmt.Fprintf(e, "%d:%s", len(b), b)
+}
+
+// unixMilli writes the time in v as Unix milliseconds,
+// for a field with the "unixms" option.
+func (e *encodeState) unixMilli(v reflect.Value) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.WriteString("0:")
+			return
+		}
+		v = v.Elem()
+	}
+	t := v.Interface().(time.Time)
+	e.Write(AppendInt(e.scratch[:0], t.Unix()*1000+int64(t.Nanosecond()/1e6)))
+}
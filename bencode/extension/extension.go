@@ -0,0 +1,151 @@
+// Package extension implements the bencoded messages of the
+// peer wire extension protocol, BEP 10, and the metadata
+// exchange of BEP 9.
+//
+// Extension messages are sent as peer wire messages with ID 20
+// whose payload begins with an extended message ID. ID 0 is the
+// handshake, which maps extension names to the IDs the sender
+// will accept them with.
+package extension
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// MessageID is the peer wire message ID of extension messages.
+const MessageID = 20
+
+// HandshakeID is the extended message ID of the handshake.
+const HandshakeID = 0
+
+// UTMetadata is the name of the metadata extension in a handshake.
+const UTMetadata = "ut_metadata"
+
+// A Handshake is the dictionary of an extension handshake.
+type Handshake struct {
+	// M maps the names of supported extensions to their message
+	// IDs. An ID of 0 disables an extension enabled earlier.
+	M map[string]int `bencode:"m"`
+
+	V    string `bencode:"v,omitempty"`    // client name and version
+	P    int    `bencode:"p,omitempty"`    // local TCP listen port
+	Reqq int    `bencode:"reqq,omitempty"` // number of outstanding requests
+
+	// YourIP is the compact IP address of the receiver.
+	YourIP []byte `bencode:"yourip,omitempty"`
+
+	// MetadataSize is the size of the info dictionary,
+	// sent by peers supporting ut_metadata that have it.
+	MetadataSize int64 `bencode:"metadata_size,omitempty"`
+}
+
+// Marshal returns the bencoding of h.
+func (h *Handshake) Marshal() ([]byte, error) {
+	return bencode.Marshal(h)
+}
+
+// ParseHandshake decodes the payload of a handshake.
+func ParseHandshake(b []byte) (*Handshake, error) {
+	h := new(Handshake)
+	if err := bencode.Unmarshal(b, h); err != nil {
+		return nil, err
+	}
+	if h.MetadataSize < 0 {
+		return nil, fmt.Errorf("extension: invalid metadata_size %d", h.MetadataSize)
+	}
+	return h, nil
+}
+
+// AppendMessage appends to b the peer wire message carrying
+// the extended message id with payload.
+func AppendMessage(b []byte, id byte, payload []byte) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], uint32(2+len(payload)))
+	b = append(b, n[:]...)
+	b = append(b, MessageID, id)
+	return append(b, payload...)
+}
+
+// Metadata message types.
+const (
+	MetadataRequest = 0
+	MetadataData    = 1
+	MetadataReject  = 2
+)
+
+// MetadataPieceSize is the size of a metadata piece.
+// Only the last piece may be shorter.
+const MetadataPieceSize = 16 << 10
+
+// A MetadataMsg is a ut_metadata message.
+type MetadataMsg struct {
+	Type  int `bencode:"msg_type"`
+	Piece int `bencode:"piece"`
+
+	// TotalSize is the size of the metadata,
+	// sent with data messages.
+	TotalSize int64 `bencode:"total_size,omitempty"`
+
+	// Data is the piece of a data message. It follows the
+	// dictionary in the payload, and is not bencoded.
+	Data []byte `bencode:"-"`
+}
+
+// Marshal returns the payload of m.
+func (m *MetadataMsg) Marshal() ([]byte, error) {
+	b, err := bencode.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	if m.Type == MetadataData {
+		b = append(b, m.Data...)
+	}
+	return b, nil
+}
+
+// ParseMetadataMsg decodes the payload of a ut_metadata message.
+// The Data of a data message refers to b.
+func ParseMetadataMsg(b []byte) (*MetadataMsg, error) {
+	m := new(MetadataMsg)
+	rest, err := bencode.UnmarshalPrefix(b, m)
+	if err != nil {
+		return nil, err
+	}
+	switch m.Type {
+	case MetadataRequest, MetadataReject:
+		if len(rest) > 0 {
+			return nil, errors.New("extension: data after metadata request or reject")
+		}
+	case MetadataData:
+		m.Data = rest
+	default:
+		return nil, fmt.Errorf("extension: unknown metadata message type %d", m.Type)
+	}
+	if m.Piece < 0 {
+		return nil, fmt.Errorf("extension: invalid metadata piece %d", m.Piece)
+	}
+	return m, nil
+}
+
+// MetadataPiece returns the data message for piece i of metadata,
+// or a reject message if there is no such piece.
+func MetadataPiece(metadata []byte, i int) *MetadataMsg {
+	off := i * MetadataPieceSize
+	if i < 0 || off >= len(metadata) {
+		return &MetadataMsg{Type: MetadataReject, Piece: i}
+	}
+	end := off + MetadataPieceSize
+	if end > len(metadata) {
+		end = len(metadata)
+	}
+	return &MetadataMsg{
+		Type:      MetadataData,
+		Piece:     i,
+		TotalSize: int64(len(metadata)),
+		Data:      metadata[off:end],
+	}
+}
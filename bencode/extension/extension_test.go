@@ -0,0 +1,154 @@
+package extension
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"reflect"
+	"testing"
+)
+
+func TestHandshake(t *testing.T) {
+	in := "d1:md11:ut_metadatai3e6:ut_pexi0ee13:metadata_sizei31235e1:pi6881e4:reqqi250e1:v13:Example 1.2.3e"
+	h, err := ParseHandshake([]byte(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Handshake{
+		M:            map[string]int{UTMetadata: 3, "ut_pex": 0},
+		V:            "Example 1.2.3",
+		P:            6881,
+		Reqq:         250,
+		MetadataSize: 31235,
+	}
+	if !reflect.DeepEqual(h, want) {
+		t.Errorf("got %+v, want %+v", h, want)
+	}
+	b, err := h.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != in {
+		t.Errorf("Marshal: got %q, want %q", b, in)
+	}
+
+	msg := AppendMessage(nil, HandshakeID, b)
+	if len(msg) != 6+len(b) || msg[3] != byte(2+len(b)) || msg[4] != MessageID || msg[5] != HandshakeID {
+		t.Errorf("AppendMessage: got %q", msg)
+	}
+}
+
+var metadataMsgTests = []struct {
+	in  string
+	out *MetadataMsg
+}{
+	{"d8:msg_typei0e5:piecei0ee", &MetadataMsg{Type: MetadataRequest}},
+	{"d8:msg_typei2e5:piecei3ee", &MetadataMsg{Type: MetadataReject, Piece: 3}},
+	{"d8:msg_typei1e5:piecei1e10:total_sizei16390eexxxxxx",
+		&MetadataMsg{Type: MetadataData, Piece: 1, TotalSize: 16390, Data: []byte("xxxxxx")}},
+	// The piece may itself look like bencode.
+	{"d8:msg_typei1e5:piecei0e10:total_sizei3eei1e",
+		&MetadataMsg{Type: MetadataData, TotalSize: 3, Data: []byte("i1e")}},
+}
+
+func TestMetadataMsg(t *testing.T) {
+	for _, tt := range metadataMsgTests {
+		m, err := ParseMetadataMsg([]byte(tt.in))
+		if err != nil {
+			t.Errorf("ParseMetadataMsg(%q): %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, tt.out) {
+			t.Errorf("ParseMetadataMsg(%q): got %+v, want %+v", tt.in, m, tt.out)
+		}
+		b, err := tt.out.Marshal()
+		if err != nil {
+			t.Errorf("Marshal(%+v): %s", tt.out, err)
+		} else if string(b) != tt.in {
+			t.Errorf("Marshal: got %q, want %q", b, tt.in)
+		}
+	}
+
+	for _, in := range []string{
+		"d8:msg_typei0e5:piecei0eexx",
+		"d8:msg_typei7e5:piecei0ee",
+		"d8:msg_typei0e5:piecei-1ee",
+		"d8:msg_typei1e5:piecei0e",
+	} {
+		if m, err := ParseMetadataMsg([]byte(in)); err == nil {
+			t.Errorf("ParseMetadataMsg(%q): got %+v, want error", in, m)
+		}
+	}
+}
+
+func TestAssembler(t *testing.T) {
+	metadata := bytes.Repeat([]byte("d4:name4:teste"), 3000)
+	infoHash := sha1.Sum(metadata)
+
+	a, err := NewAssembler(infoHash, int64(len(metadata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.NumPieces() != 3 {
+		t.Fatalf("got %d pieces", a.NumPieces())
+	}
+
+	// Pieces pass through the wire encoding in reverse order.
+	for i := a.NumPieces() - 1; i >= 0; i-- {
+		b, err := MetadataPiece(metadata, i).Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseMetadataMsg(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = a.Add(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !a.Complete() || len(a.Missing()) != 0 {
+		t.Fatalf("missing pieces %v", a.Missing())
+	}
+	got, err := a.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, metadata) {
+		t.Error("assembled metadata differs")
+	}
+
+	if m := MetadataPiece(metadata, 3); m.Type != MetadataReject {
+		t.Errorf("piece past end: got %+v", m)
+	}
+	for _, m := range []*MetadataMsg{
+		{Type: MetadataReject, Piece: 0},
+		{Type: MetadataData, Piece: 3, TotalSize: int64(len(metadata))},
+		{Type: MetadataData, Piece: 0, TotalSize: 5, Data: metadata[:MetadataPieceSize]},
+		{Type: MetadataData, Piece: 2, TotalSize: int64(len(metadata)), Data: metadata[:MetadataPieceSize]},
+	} {
+		if err = a.Add(m); err == nil {
+			t.Errorf("Add(%d, %d, %d bytes) succeeded", m.Type, m.Piece, len(m.Data))
+		}
+	}
+}
+
+func TestAssemblerMismatch(t *testing.T) {
+	metadata := []byte("d4:name4:teste")
+	a, err := NewAssembler(sha1.Sum([]byte("other")), int64(len(metadata)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.Add(MetadataPiece(metadata, 0)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Metadata(); err != ErrHashMismatch {
+		t.Errorf("got %v, want ErrHashMismatch", err)
+	}
+	if a.Complete() || !reflect.DeepEqual(a.Missing(), []int{0}) {
+		t.Errorf("pieces kept after mismatch: missing %v", a.Missing())
+	}
+
+	if _, err = NewAssembler([20]byte{}, MaxMetadataSize+1); err == nil {
+		t.Error("oversized metadata accepted")
+	}
+}
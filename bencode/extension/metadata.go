@@ -0,0 +1,105 @@
+package extension
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+)
+
+// MaxMetadataSize is the largest metadata an Assembler accepts.
+const MaxMetadataSize = 8 << 20
+
+// ErrHashMismatch is returned by Assembler.Metadata when the
+// assembled metadata does not match the info-hash.
+var ErrHashMismatch = errors.New("extension: metadata does not match info-hash")
+
+// An Assembler collects the pieces of the metadata of a torrent,
+// received in ut_metadata data messages, and checks the result
+// against the info-hash.
+type Assembler struct {
+	infoHash [20]byte
+	size     int64
+	pieces   [][]byte
+	have     int
+}
+
+// NewAssembler returns an Assembler for metadata of the given size,
+// as advertised in the metadata_size of a handshake.
+func NewAssembler(infoHash [20]byte, size int64) (*Assembler, error) {
+	if size <= 0 || size > MaxMetadataSize {
+		return nil, fmt.Errorf("extension: invalid metadata size %d", size)
+	}
+	n := (size + MetadataPieceSize - 1) / MetadataPieceSize
+	return &Assembler{
+		infoHash: infoHash,
+		size:     size,
+		pieces:   make([][]byte, n),
+	}, nil
+}
+
+// NumPieces returns the number of pieces of the metadata.
+func (a *Assembler) NumPieces() int { return len(a.pieces) }
+
+// Missing returns the indices of the pieces not yet received.
+func (a *Assembler) Missing() []int {
+	var missing []int
+	for i, p := range a.pieces {
+		if p == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Complete reports whether every piece has been received.
+func (a *Assembler) Complete() bool { return a.have == len(a.pieces) }
+
+// pieceLen returns the length of piece i.
+func (a *Assembler) pieceLen(i int) int {
+	if i == len(a.pieces)-1 {
+		return int(a.size - int64(i)*MetadataPieceSize)
+	}
+	return MetadataPieceSize
+}
+
+// Add stores the piece of a data message. The data is copied.
+// A piece received twice replaces the earlier copy.
+func (a *Assembler) Add(m *MetadataMsg) error {
+	if m.Type != MetadataData {
+		return fmt.Errorf("extension: metadata message type %d is not data", m.Type)
+	}
+	if m.TotalSize != a.size {
+		return fmt.Errorf("extension: metadata total_size %d, want %d", m.TotalSize, a.size)
+	}
+	if m.Piece < 0 || m.Piece >= len(a.pieces) {
+		return fmt.Errorf("extension: metadata piece %d out of range", m.Piece)
+	}
+	if n := a.pieceLen(m.Piece); len(m.Data) != n {
+		return fmt.Errorf("extension: metadata piece %d has length %d, want %d", m.Piece, len(m.Data), n)
+	}
+	if a.pieces[m.Piece] == nil {
+		a.have++
+	}
+	a.pieces[m.Piece] = append([]byte(nil), m.Data...)
+	return nil
+}
+
+// Metadata returns the assembled metadata, the bencoded info
+// dictionary. If its SHA-1 hash is not the info-hash, all pieces
+// are discarded and ErrHashMismatch is returned, as the bad piece
+// cannot be identified.
+func (a *Assembler) Metadata() ([]byte, error) {
+	if !a.Complete() {
+		return nil, fmt.Errorf("extension: %d metadata pieces missing", len(a.pieces)-a.have)
+	}
+	b := bytes.Join(a.pieces, nil)
+	if sha1.Sum(b) != a.infoHash {
+		for i := range a.pieces {
+			a.pieces[i] = nil
+		}
+		a.have = 0
+		return nil, ErrHashMismatch
+	}
+	return b, nil
+}
@@ -16,6 +16,14 @@ type scanner struct {
 	// Error that happened, if any.
 	err error
 
+	// Reject input that is not in canonical form.
+	strict bool
+
+	// Limits to enforce, if not nil, and the number of elements
+	// read at each level of parseState.
+	limits *DecoderOptions
+	counts []int
+
 	// storage for string length numeral bytes
 	strLen int
 
@@ -25,9 +33,16 @@ type scanner struct {
 
 // stateBeginValue is the state at the beginning of the input.
 func stateBeginValue(s *scanner, c int) int {
+	if s.limits != nil && s.checkBegin(c) == scanError {
+		return scanError
+	}
 	switch c {
 	case 'i':
-		s.step = stateParseInteger
+		if s.strict {
+			s.step = stateBeginInteger
+		} else {
+			s.step = stateParseInteger
+		}
 		s.pushParseState(parseInteger)
 		return scanBeginInteger
 	case 'l':
@@ -51,18 +66,28 @@ func stateBeginValue(s *scanner, c int) int {
 
 func stateParseStringLen(s *scanner, c int) int {
 	if c == ':' {
+		if s.checkStringLen(s.strLen) == scanError {
+			return scanError
+		}
 		// decoder should read this string as a slice
 		s.popParseState()
-		// BUG(emery): undefined behavior with top level strings
-
-		// this is a problem, if this string is a top-level object,
-		// the fact that this scanner has reached the end isn't communicated.
-		// I guess I could shift the string length and set scanEnd bits
+		// The caller skips the bytes of the string. If it is
+		// a top-level value, popParseState has set endTop, and
+		// the value ends with the last of those bytes.
 		return s.strLen
 	}
 	if c >= '0' && c <= '9' {
+		if s.strict && s.strLen == 0 {
+			return s.error(c, "after leading zero in string length")
+		}
+		if s.strLen > (maxInt-9)/10 {
+			return s.error(c, "in string length that is too large")
+		}
 		s.strLen *= 10
 		s.strLen += (c & 0xcf)
+		if s.checkStringLen(s.strLen) == scanError {
+			return scanError
+		}
 		return scanParseStringLen
 	}
 	return s.error(c, "in string length")
@@ -77,6 +102,9 @@ func stateBeginDictKey(s *scanner, c int) int {
 		return scanEndDict
 	}
 	if c >= '0' && c <= '9' {
+		if s.limits != nil && s.countElement() == scanError {
+			return scanError
+		}
 		s.strLen = (c & 0xcf)
 		s.step = stateParseKeyLen
 		return scanBeginKeyLen
@@ -86,14 +114,26 @@ func stateBeginDictKey(s *scanner, c int) int {
 
 func stateParseKeyLen(s *scanner, c int) int {
 	if c == ':' {
+		if s.checkStringLen(s.strLen) == scanError {
+			return scanError
+		}
 		s.step = stateBeginValue
 
 		// decoder should read this key chunk at once
 		return s.strLen
 	}
 	if c >= '0' && c <= '9' {
+		if s.strict && s.strLen == 0 {
+			return s.error(c, "after leading zero in dictionary key length")
+		}
+		if s.strLen > (maxInt-9)/10 {
+			return s.error(c, "in dictionary key length that is too large")
+		}
 		s.strLen *= 10
 		s.strLen += (c & 0xcf)
+		if s.checkStringLen(s.strLen) == scanError {
+			return scanError
+		}
 		return scanParseKeyLen
 	}
 	return s.error(c, "in dictionary key length")
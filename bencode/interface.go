@@ -20,12 +20,12 @@ type Unmarshaler interface {
 // It is intedended to delay decoding or precomute an encoding.
 type RawMessage []byte
 
-// MarshalText returns *m as the bencode encoding of m.
-func (m *RawMessage) MarshalBencode() ([]byte, error) {
+// MarshalBencode returns m as the bencode encoding of m.
+func (m RawMessage) MarshalBencode() ([]byte, error) {
 	if m == nil {
 		return []byte{'0', ':'}, nil
 	}
-	return *m, nil
+	return m, nil
 }
 
 // UnmarshalText sets *m to a copy of data.
@@ -37,5 +37,5 @@ func (m *RawMessage) UnmarshalBencode(text []byte) error {
 	return nil
 }
 
-var _ Marshaler = (*RawMessage)(nil)
+var _ Marshaler = (RawMessage)(nil)
 var _ Unmarshaler = (*RawMessage)(nil)
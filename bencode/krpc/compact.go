@@ -0,0 +1,159 @@
+package krpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// An Addr is a UDP or TCP address in compact peer info form,
+// 4 or 16 bytes of IP address followed by a 2 byte port,
+// both in network byte order.
+type Addr struct {
+	IP   net.IP
+	Port int
+}
+
+func (a Addr) String() string {
+	return net.JoinHostPort(a.IP.String(), fmt.Sprint(a.Port))
+}
+
+// UDPAddr returns a as a *net.UDPAddr.
+func (a Addr) UDPAddr() *net.UDPAddr {
+	return &net.UDPAddr{IP: a.IP, Port: a.Port}
+}
+
+// AddrFromUDP returns the Addr of u.
+func AddrFromUDP(u *net.UDPAddr) Addr {
+	return Addr{IP: u.IP, Port: u.Port}
+}
+
+// compact appends the compact form of a to b.
+func (a Addr) compact(b []byte) []byte {
+	if ip4 := a.IP.To4(); ip4 != nil {
+		b = append(b, ip4...)
+	} else {
+		b = append(b, a.IP.To16()...)
+	}
+	return append(b, byte(a.Port>>8), byte(a.Port))
+}
+
+// parseAddr decodes a compact address of 6 or 18 bytes.
+func parseAddr(b []byte) (a Addr, err error) {
+	switch len(b) {
+	case net.IPv4len + 2, net.IPv6len + 2:
+	default:
+		return a, fmt.Errorf("krpc: compact address has length %d", len(b))
+	}
+	n := len(b) - 2
+	a.IP = append(net.IP(nil), b[:n]...)
+	a.Port = int(binary.BigEndian.Uint16(b[n:]))
+	return a, nil
+}
+
+// MarshalBencode encodes a as a compact address string.
+func (a Addr) MarshalBencode() ([]byte, error) {
+	if a.IP.To16() == nil {
+		return nil, fmt.Errorf("krpc: invalid IP address %v", a.IP)
+	}
+	return bencode.Marshal(a.compact(nil))
+}
+
+// UnmarshalBencode decodes a compact address string into a.
+func (a *Addr) UnmarshalBencode(b []byte) error {
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	addr, err := parseAddr(s)
+	if err != nil {
+		return err
+	}
+	*a = addr
+	return nil
+}
+
+// NodeInfo is the ID and address of a DHT node.
+type NodeInfo struct {
+	ID   ID
+	Addr Addr
+}
+
+// Lengths of compact node info.
+const (
+	nodeLen  = 20 + net.IPv4len + 2
+	node6Len = 20 + net.IPv6len + 2
+)
+
+// Nodes is a list of IPv4 nodes, encoded as a
+// string of concatenated 26 byte compact node info.
+type Nodes []NodeInfo
+
+// Nodes6 is a list of IPv6 nodes, encoded as a string
+// of concatenated 38 byte compact node info, as
+// described by BEP 32.
+type Nodes6 []NodeInfo
+
+// MarshalBencode encodes n as compact node info.
+func (n Nodes) MarshalBencode() ([]byte, error) {
+	return marshalNodes(n, net.IPv4len)
+}
+
+// UnmarshalBencode decodes compact node info into n.
+func (n *Nodes) UnmarshalBencode(b []byte) error {
+	nodes, err := unmarshalNodes(b, nodeLen)
+	*n = nodes
+	return err
+}
+
+// MarshalBencode encodes n as compact node info.
+func (n Nodes6) MarshalBencode() ([]byte, error) {
+	return marshalNodes(n, net.IPv6len)
+}
+
+// UnmarshalBencode decodes compact node info into n.
+func (n *Nodes6) UnmarshalBencode(b []byte) error {
+	nodes, err := unmarshalNodes(b, node6Len)
+	*n = nodes
+	return err
+}
+
+func marshalNodes(nodes []NodeInfo, ipLen int) ([]byte, error) {
+	s := make([]byte, 0, len(nodes)*(20+ipLen+2))
+	for _, n := range nodes {
+		ip := n.Addr.IP.To4()
+		if ipLen == net.IPv6len {
+			if ip != nil {
+				return nil, fmt.Errorf("krpc: node %s has an IPv4 address", n.ID)
+			}
+			ip = n.Addr.IP.To16()
+		}
+		if len(ip) != ipLen {
+			return nil, fmt.Errorf("krpc: node %s has invalid address %v", n.ID, n.Addr.IP)
+		}
+		s = append(s, n.ID[:]...)
+		s = append(s, ip...)
+		s = append(s, byte(n.Addr.Port>>8), byte(n.Addr.Port))
+	}
+	return bencode.Marshal(s)
+}
+
+func unmarshalNodes(b []byte, size int) ([]NodeInfo, error) {
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	if len(s)%size != 0 {
+		return nil, fmt.Errorf("krpc: compact node info has length %d", len(s))
+	}
+	var nodes []NodeInfo
+	for ; len(s) > 0; s = s[size:] {
+		var n NodeInfo
+		copy(n.ID[:], s)
+		n.Addr, _ = parseAddr(s[20:size])
+		nodes = append(nodes, n)
+	}
+	return nodes, nil
+}
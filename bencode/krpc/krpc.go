@@ -0,0 +1,193 @@
+// Package krpc implements the KRPC protocol of the
+// BitTorrent Mainline DHT, described by BEP 5.
+//
+// KRPC messages are bencoded dictionaries sent over UDP.
+// A query carries a method name and arguments, and is
+// answered by a response or an error with the same
+// transaction ID.
+package krpc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// Message types, the values of the "y" key.
+const (
+	TypeQuery    = "q"
+	TypeResponse = "r"
+	TypeError    = "e"
+)
+
+// Query methods, the values of the "q" key.
+const (
+	MethodPing         = "ping"
+	MethodFindNode     = "find_node"
+	MethodGetPeers     = "get_peers"
+	MethodAnnouncePeer = "announce_peer"
+)
+
+// A Msg is a KRPC message.
+type Msg struct {
+	T string  `bencode:"t"`           // transaction ID
+	Y string  `bencode:"y"`           // message type
+	Q string  `bencode:"q,omitempty"` // query method
+	A *Args   `bencode:"a,omitempty"` // query arguments
+	R *Return `bencode:"r,omitempty"` // response values
+	E *Error  `bencode:"e,omitempty"` // error
+
+	// V is the client version string of BEP 20.
+	V string `bencode:"v,omitempty"`
+
+	// IP is the compact address of the recipient, from BEP 42.
+	IP *Addr `bencode:"ip,omitempty"`
+
+	// ReadOnly is set by nodes that do not respond to queries, BEP 43.
+	ReadOnly int `bencode:"ro,omitempty"`
+}
+
+// Args are the arguments of a query.
+type Args struct {
+	ID ID `bencode:"id"`
+
+	// find_node
+	Target *ID `bencode:"target,omitempty"`
+
+	// get_peers and announce_peer
+	InfoHash *ID `bencode:"info_hash,omitempty"`
+
+	// announce_peer
+	Port        int    `bencode:"port,omitempty"`
+	Token       string `bencode:"token,omitempty"`
+	ImpliedPort int    `bencode:"implied_port,omitempty"`
+
+	// Want lists the address families wanted in the response,
+	// "n4" and "n6", as described by BEP 32.
+	Want []string `bencode:"want,omitempty"`
+}
+
+// Return holds the values of a response.
+type Return struct {
+	ID ID `bencode:"id"`
+
+	// find_node and get_peers
+	Nodes  Nodes  `bencode:"nodes,omitempty"`
+	Nodes6 Nodes6 `bencode:"nodes6,omitempty"`
+
+	// get_peers
+	Token  string `bencode:"token,omitempty"`
+	Values []Addr `bencode:"values,omitempty"`
+}
+
+// Marshal returns the bencoding of m.
+func (m *Msg) Marshal() ([]byte, error) {
+	return bencode.Marshal(m)
+}
+
+// limits bound the resources used to decode a message
+// from the network.
+var limits = bencode.DecoderOptions{
+	MaxDepth:     8,
+	MaxElements:  1024,
+	MaxValueSize: maxPacket,
+}
+
+// Unmarshal decodes a message from b and checks
+// that it has the keys required by its type.
+func Unmarshal(b []byte) (*Msg, error) {
+	m := new(Msg)
+	dec := bencode.NewDecoder(bytes.NewReader(b))
+	dec.SetOptions(limits)
+	if err := dec.Decode(m); err != nil {
+		return nil, err
+	}
+	switch m.Y {
+	case TypeQuery:
+		if m.Q == "" || m.A == nil {
+			return nil, errors.New("krpc: query without method or arguments")
+		}
+	case TypeResponse:
+		if m.R == nil {
+			return nil, errors.New("krpc: response without values")
+		}
+	case TypeError:
+		if m.E == nil {
+			return nil, errors.New("krpc: error message without error")
+		}
+	default:
+		return nil, fmt.Errorf("krpc: unknown message type %q", m.Y)
+	}
+	return m, nil
+}
+
+// An ID is a 160-bit node ID or info-hash.
+type ID [20]byte
+
+// String returns id in hexadecimal.
+func (id ID) String() string { return fmt.Sprintf("%x", id[:]) }
+
+// MarshalBencode encodes id as a 20 byte string.
+func (id ID) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal(id[:])
+}
+
+// UnmarshalBencode decodes a 20 byte string into id.
+func (id *ID) UnmarshalBencode(b []byte) error {
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if len(s) != len(id) {
+		return fmt.Errorf("krpc: ID has length %d", len(s))
+	}
+	copy(id[:], s)
+	return nil
+}
+
+// Error codes.
+const (
+	ErrorGeneric       = 201
+	ErrorServer        = 202
+	ErrorProtocol      = 203
+	ErrorMethodUnknown = 204
+)
+
+// An Error is a KRPC error, encoded as a list of
+// an integer code and a message.
+type Error struct {
+	Code int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("krpc: error %d: %s", e.Code, e.Msg)
+}
+
+// MarshalBencode encodes e as a list.
+func (e Error) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]interface{}{e.Code, e.Msg})
+}
+
+// UnmarshalBencode decodes a list of code and message into e.
+func (e *Error) UnmarshalBencode(b []byte) error {
+	var l []interface{}
+	if err := bencode.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	if len(l) != 2 {
+		return fmt.Errorf("krpc: error list has %d elements", len(l))
+	}
+	code, ok := l[0].(int64)
+	if !ok {
+		return errors.New("krpc: error code is not an integer")
+	}
+	msg, ok := l[1].([]byte)
+	if !ok {
+		return errors.New("krpc: error message is not a string")
+	}
+	e.Code, e.Msg = int(code), string(msg)
+	return nil
+}
@@ -0,0 +1,300 @@
+package krpc
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func testID(c byte) (id ID) {
+	for i := range id {
+		id[i] = c
+	}
+	return id
+}
+
+var msgTests = []struct {
+	in  string
+	out *Msg
+}{
+	// Examples from BEP 5.
+	{"d1:ad2:id20:abcdefghij0123456789e1:q4:ping1:t2:aa1:y1:qe",
+		&Msg{T: "aa", Y: "q", Q: "ping", A: &Args{ID: ID{'a', 'b', 'c', 'd', 'e', 'f', 'g', 'h', 'i', 'j', '0', '1', '2', '3', '4', '5', '6', '7', '8', '9'}}}},
+	{"d1:eli201e23:A Generic Error Ocurrede1:t2:aa1:y1:ee",
+		&Msg{T: "aa", Y: "e", E: &Error{201, "A Generic Error Ocurred"}}},
+	{"d1:ad2:id20:aaaaaaaaaaaaaaaaaaaa12:implied_porti1e9:info_hash20:bbbbbbbbbbbbbbbbbbbb4:porti6881e5:token8:aoeusnthe1:q13:announce_peer1:t2:aa1:y1:qe",
+		&Msg{T: "aa", Y: "q", Q: "announce_peer", A: &Args{
+			ID:          testID('a'),
+			InfoHash:    &ID{'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b', 'b'},
+			Port:        6881,
+			Token:       "aoeusnth",
+			ImpliedPort: 1,
+		}}},
+	{"d1:rd2:id20:aaaaaaaaaaaaaaaaaaaa5:nodes26:bbbbbbbbbbbbbbbbbbbb\x7f\x00\x00\x01\x1a\xe15:token2:tk6:valuesl6:\x0a\x00\x00\x01\x1a\xe118:\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x50ee1:t2:aa1:y1:re",
+		&Msg{T: "aa", Y: "r", R: &Return{
+			ID:    testID('a'),
+			Nodes: Nodes{{testID('b'), Addr{net.IP{127, 0, 0, 1}, 6881}}},
+			Token: "tk",
+			Values: []Addr{
+				{net.IP{10, 0, 0, 1}, 6881},
+				{net.ParseIP("2001:db8::1"), 80},
+			},
+		}}},
+}
+
+func TestMsg(t *testing.T) {
+	for _, tt := range msgTests {
+		m, err := Unmarshal([]byte(tt.in))
+		if err != nil {
+			t.Errorf("Unmarshal(%q): %s", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(m, tt.out) {
+			t.Errorf("Unmarshal(%q):\ngot  %+v\nwant %+v", tt.in, m, tt.out)
+		}
+		b, err := tt.out.Marshal()
+		if err != nil {
+			t.Errorf("Marshal(%+v): %s", tt.out, err)
+			continue
+		}
+		if string(b) != tt.in {
+			t.Errorf("Marshal:\ngot  %q\nwant %q", b, tt.in)
+		}
+	}
+}
+
+func TestUnmarshalInvalid(t *testing.T) {
+	for _, in := range []string{
+		"d1:t2:aa1:y1:qe",               // no method
+		"d1:t2:aa1:y1:xe",               // unknown type
+		"d1:rd2:id3:abce1:t2:aa1:y1:re", // short ID
+		"d1:eli201ee1:t2:aa1:y1:ee",     // short error list
+		"d1:rd2:id20:aaaaaaaaaaaaaaaaaaaa5:nodes3:abce1:t2:aa1:y1:re", // short nodes
+	} {
+		if m, err := Unmarshal([]byte(in)); err == nil {
+			t.Errorf("Unmarshal(%q): got %+v, want error", in, m)
+		}
+	}
+}
+
+func TestNodes6(t *testing.T) {
+	in := Nodes6{
+		{testID('x'), Addr{net.ParseIP("2001:db8::1"), 6881}},
+		{testID('y'), Addr{net.ParseIP("fe80::2"), 1}},
+	}
+	b, err := bencode.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "76:"; string(b[:3]) != want {
+		t.Errorf("got %q, want prefix %q", b, want)
+	}
+	var out Nodes6
+	if err = bencode.Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("got %v, want %v", out, in)
+	}
+
+	if _, err = bencode.Marshal(Nodes6{{Addr: Addr{net.IP{1, 2, 3, 4}, 1}}}); err == nil {
+		t.Error("IPv4 node encoded as Nodes6")
+	}
+	if _, err = bencode.Marshal(Nodes{{Addr: Addr{net.ParseIP("::1"), 1}}}); err == nil {
+		t.Error("IPv6 node encoded as Nodes")
+	}
+}
+
+func listen(t *testing.T, h Handler) *Transport {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTransport(conn, h)
+}
+
+func TestTransport(t *testing.T) {
+	serverID, clientID := testID('s'), testID('c')
+	infoHash := testID('i')
+	peers := []Addr{{net.IP{10, 0, 0, 1}, 6881}}
+
+	server := listen(t, func(addr Addr, m *Msg) (*Return, error) {
+		r := &Return{ID: serverID}
+		switch m.Q {
+		case MethodPing:
+		case MethodFindNode:
+			r.Nodes = Nodes{{*m.A.Target, addr}}
+		case MethodGetPeers:
+			r.Token = "token"
+			r.Values = peers
+		case MethodAnnouncePeer:
+			if m.A.Token != "token" {
+				return nil, &Error{ErrorProtocol, "Bad Token"}
+			}
+		default:
+			return nil, errors.New("not implemented")
+		}
+		return r, nil
+	})
+	defer server.Close()
+	client := listen(t, nil)
+	defer client.Close()
+	addr := server.LocalAddr().(*net.UDPAddr)
+
+	r, err := client.Ping(addr, clientID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != serverID {
+		t.Errorf("ping: got ID %s", r.ID)
+	}
+
+	target := testID('t')
+	if r, err = client.FindNode(addr, clientID, target); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Nodes) != 1 || r.Nodes[0].ID != target || r.Nodes[0].Addr.String() != client.LocalAddr().String() {
+		t.Errorf("find_node: got %v", r.Nodes)
+	}
+
+	if r, err = client.GetPeers(addr, clientID, infoHash); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(r.Values, peers) || r.Token != "token" {
+		t.Errorf("get_peers: got %+v", r)
+	}
+
+	if _, err = client.AnnouncePeer(addr, clientID, infoHash, 0, "token"); err != nil {
+		t.Error(err)
+	}
+	_, err = client.AnnouncePeer(addr, clientID, infoHash, 6881, "bad")
+	if e, ok := err.(*Error); !ok || e.Code != ErrorProtocol {
+		t.Errorf("announce_peer with bad token: got %v", err)
+	}
+
+	_, err = client.Query(addr, "vote", &Args{ID: clientID})
+	if e, ok := err.(*Error); !ok || e.Code != ErrorServer {
+		t.Errorf("unknown method: got %v", err)
+	}
+
+	// The client has no handler.
+	_, err = server.Ping(client.LocalAddr().(*net.UDPAddr), serverID)
+	if e, ok := err.(*Error); !ok || e.Code != ErrorMethodUnknown {
+		t.Errorf("query without handler: got %v", err)
+	}
+}
+
+func TestTransportTimeout(t *testing.T) {
+	// A node that never answers.
+	silent := listen(t, func(Addr, *Msg) (*Return, error) { return nil, nil })
+	defer silent.Close()
+	client := listen(t, nil)
+	client.Timeout = 50 * time.Millisecond
+
+	addr := silent.LocalAddr().(*net.UDPAddr)
+	if _, err := client.Ping(addr, testID('c')); err != ErrTimeout {
+		t.Errorf("got %v, want ErrTimeout", err)
+	}
+
+	client.Close()
+	if _, err := client.Ping(addr, testID('c')); err != ErrClosed {
+		t.Errorf("after Close: got %v, want ErrClosed", err)
+	}
+}
+
+// failConn is a PacketConn whose reads fail with the
+// error sent on fail.
+type failConn struct {
+	net.PacketConn
+	fail chan error
+}
+
+func (c *failConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	return 0, nil, <-c.fail
+}
+
+func TestTransportReadError(t *testing.T) {
+	silent := listen(t, func(Addr, *Msg) (*Return, error) { return nil, nil })
+	defer silent.Close()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fc := &failConn{conn, make(chan error)}
+	client := NewTransport(fc, nil)
+	defer client.Close()
+
+	addr := silent.LocalAddr().(*net.UDPAddr)
+	errc := make(chan error)
+	go func() {
+		_, err := client.Ping(addr, testID('c'))
+		errc <- err
+	}()
+	for {
+		client.mu.Lock()
+		n := len(client.pending)
+		client.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	readErr := errors.New("read failed")
+	fc.fail <- readErr
+	if err := <-errc; err != readErr {
+		t.Errorf("pending query: got %v, want %v", err, readErr)
+	}
+	if _, err := client.Ping(addr, testID('c')); err != readErr {
+		t.Errorf("later query: got %v, want %v", err, readErr)
+	}
+}
+
+func TestTransportSpoofedResponse(t *testing.T) {
+	spoofer, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spoofer.Close()
+	// A node that does not answer, but has another
+	// address answer for it with the right transaction ID.
+	silent := listen(t, func(addr Addr, m *Msg) (*Return, error) {
+		b, _ := (&Msg{T: m.T, Y: TypeResponse, R: &Return{ID: testID('x')}}).Marshal()
+		spoofer.WriteTo(b, addr.UDPAddr())
+		return nil, nil
+	})
+	defer silent.Close()
+	client := listen(t, nil)
+	defer client.Close()
+	client.Timeout = 100 * time.Millisecond
+
+	if r, err := client.Ping(silent.LocalAddr().(*net.UDPAddr), testID('c')); err != ErrTimeout {
+		t.Errorf("got %+v, %v, want ErrTimeout", r, err)
+	}
+}
+
+func TestTransportTooManyQueries(t *testing.T) {
+	client := listen(t, nil)
+	defer client.Close()
+	client.mu.Lock()
+	for i := 0; i < 1<<16; i++ {
+		client.pending[string([]byte{byte(i >> 8), byte(i)})] = pending{ch: make(chan *Msg, 1)}
+	}
+	client.mu.Unlock()
+	if _, err := client.Ping(client.LocalAddr().(*net.UDPAddr), testID('c')); err != ErrTooManyQueries {
+		t.Errorf("got %v, want ErrTooManyQueries", err)
+	}
+}
+
+func TestUnmarshalLimits(t *testing.T) {
+	deep := "d1:ad2:id20:aaaaaaaaaaaaaaaaaaaa1:x" + strings.Repeat("l", 100) + strings.Repeat("e", 100) + "e1:q4:ping1:t2:aa1:y1:qe"
+	_, err := Unmarshal([]byte(deep))
+	if _, ok := err.(*bencode.LimitError); !ok {
+		t.Errorf("got %v, want LimitError", err)
+	}
+}
@@ -0,0 +1,291 @@
+package krpc
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the time a query waits for a
+// response if Transport.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// maxPacket is the size of the receive buffer.
+const maxPacket = 1 << 16
+
+// maxHandlers limits the number of queries handled at once.
+// Queries that arrive while as many are in progress are dropped.
+const maxHandlers = 64
+
+// ErrTimeout is returned by a query that is not answered in time.
+var ErrTimeout = errors.New("krpc: query timed out")
+
+// ErrClosed is returned by a query on a closed Transport.
+var ErrClosed = errors.New("krpc: transport closed")
+
+// ErrTooManyQueries is returned by a query when every
+// transaction ID is taken by a pending query.
+var ErrTooManyQueries = errors.New("krpc: too many pending queries")
+
+// A Handler answers a query from addr. If it returns an error
+// that is not an *Error, a server error is sent to the querying
+// node. If it returns nil values and a nil error, no reply is
+// sent.
+type Handler func(addr Addr, m *Msg) (*Return, error)
+
+// A Transport sends queries and matches their responses by
+// transaction ID and address, and passes incoming queries to
+// a Handler.
+type Transport struct {
+	// Timeout is the time a query waits for a response.
+	// If zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	conn    net.PacketConn
+	handler Handler
+
+	mu      sync.Mutex
+	next    uint16
+	pending map[string]pending
+	closed  bool
+	err     error // the read error that closed the Transport
+	done    chan struct{}
+
+	handlers chan struct{} // a token for each query being handled
+}
+
+// A pending query waits for a response from addr on ch.
+type pending struct {
+	addr *net.UDPAddr
+	ch   chan *Msg
+}
+
+// NewTransport returns a Transport reading from conn. Queries
+// received are passed to h, or answered with a method unknown
+// error if h is nil. Up to 64 queries are handled at once, and
+// those that arrive meanwhile are dropped.
+func NewTransport(conn net.PacketConn, h Handler) *Transport {
+	t := &Transport{
+		conn:     conn,
+		handler:  h,
+		pending:  make(map[string]pending),
+		done:     make(chan struct{}),
+		handlers: make(chan struct{}, maxHandlers),
+	}
+	go t.readLoop()
+	return t
+}
+
+// LocalAddr returns the local address of the Transport.
+func (t *Transport) LocalAddr() net.Addr { return t.conn.LocalAddr() }
+
+// Close closes the connection of the Transport.
+// Pending queries return ErrClosed. If a read from the
+// connection failed, the Transport is already closed.
+func (t *Transport) Close() error {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return nil
+	}
+	t.closed = true
+	t.mu.Unlock()
+	err := t.conn.Close()
+	<-t.done
+	return err
+}
+
+func (t *Transport) readLoop() {
+	defer func() {
+		t.mu.Lock()
+		for tid, p := range t.pending {
+			close(p.ch)
+			delete(t.pending, tid)
+		}
+		t.mu.Unlock()
+		close(t.done)
+	}()
+
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			// Unless Close caused it, the error is returned
+			// by pending and later queries.
+			t.mu.Lock()
+			if t.closed {
+				t.mu.Unlock()
+				return
+			}
+			t.closed = true
+			t.err = err
+			t.mu.Unlock()
+			t.conn.Close()
+			return
+		}
+		udp, ok := from.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		// Malformed packets are dropped.
+		m, err := Unmarshal(buf[:n])
+		if err != nil {
+			continue
+		}
+		if m.Y == TypeQuery {
+			select {
+			case t.handlers <- struct{}{}:
+				go func() {
+					t.serve(udp, m)
+					<-t.handlers
+				}()
+			default:
+			}
+			continue
+		}
+
+		// A response must come from the node queried,
+		// not just carry a transaction ID in use.
+		t.mu.Lock()
+		p, ok := t.pending[m.T]
+		if ok && p.addr.IP.Equal(udp.IP) && p.addr.Port == udp.Port {
+			delete(t.pending, m.T)
+		} else {
+			ok = false
+		}
+		t.mu.Unlock()
+		if ok {
+			p.ch <- m
+		}
+	}
+}
+
+// serve answers the query m from addr.
+func (t *Transport) serve(addr *net.UDPAddr, m *Msg) {
+	reply := &Msg{T: m.T, Y: TypeResponse}
+	var err error
+	if t.handler == nil {
+		err = &Error{ErrorMethodUnknown, "Method Unknown"}
+	} else {
+		reply.R, err = t.handler(AddrFromUDP(addr), m)
+	}
+	if err != nil {
+		e, ok := err.(*Error)
+		if !ok {
+			e = &Error{ErrorServer, err.Error()}
+		}
+		reply.Y, reply.R, reply.E = TypeError, nil, e
+	} else if reply.R == nil {
+		return
+	}
+	t.send(addr, reply)
+}
+
+func (t *Transport) send(addr net.Addr, m *Msg) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = t.conn.WriteTo(b, addr)
+	return err
+}
+
+// closedErr returns the error of a query on a closed Transport.
+// t.mu must be held.
+func (t *Transport) closedErr() error {
+	if t.err != nil {
+		return t.err
+	}
+	return ErrClosed
+}
+
+// Query sends a query for method with args to addr and waits
+// for the response. An error response is returned as an *Error.
+// If reading from the connection failed, the Transport was
+// closed and Query returns the read error.
+func (t *Transport) Query(addr *net.UDPAddr, method string, args *Args) (*Return, error) {
+	ch := make(chan *Msg, 1)
+	t.mu.Lock()
+	if t.closed {
+		err := t.closedErr()
+		t.mu.Unlock()
+		return nil, err
+	}
+	var tid string
+	for i := 0; ; i++ {
+		if i == 1<<16 {
+			t.mu.Unlock()
+			return nil, ErrTooManyQueries
+		}
+		t.next++
+		tid = string([]byte{byte(t.next >> 8), byte(t.next)})
+		if _, ok := t.pending[tid]; !ok {
+			break
+		}
+	}
+	t.pending[tid] = pending{addr, ch}
+	t.mu.Unlock()
+
+	err := t.send(addr, &Msg{T: tid, Y: TypeQuery, Q: method, A: args})
+	if err != nil {
+		t.forget(tid)
+		return nil, err
+	}
+
+	timeout := t.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case m, ok := <-ch:
+		if !ok {
+			t.mu.Lock()
+			err := t.closedErr()
+			t.mu.Unlock()
+			return nil, err
+		}
+		if m.Y == TypeError {
+			return nil, m.E
+		}
+		return m.R, nil
+	case <-timer.C:
+		t.forget(tid)
+		return nil, ErrTimeout
+	}
+}
+
+func (t *Transport) forget(tid string) {
+	t.mu.Lock()
+	delete(t.pending, tid)
+	t.mu.Unlock()
+}
+
+// Ping sends a ping query to addr from node id.
+func (t *Transport) Ping(addr *net.UDPAddr, id ID) (*Return, error) {
+	return t.Query(addr, MethodPing, &Args{ID: id})
+}
+
+// FindNode asks addr for the nodes closest to target.
+func (t *Transport) FindNode(addr *net.UDPAddr, id, target ID) (*Return, error) {
+	return t.Query(addr, MethodFindNode, &Args{ID: id, Target: &target})
+}
+
+// GetPeers asks addr for peers of the torrent with infoHash.
+func (t *Transport) GetPeers(addr *net.UDPAddr, id, infoHash ID) (*Return, error) {
+	return t.Query(addr, MethodGetPeers, &Args{ID: id, InfoHash: &infoHash})
+}
+
+// AnnouncePeer announces to addr that the querying node is a
+// peer of the torrent with infoHash on port, using the token of
+// an earlier get_peers response. If port is zero, the source
+// port of the query is used instead.
+func (t *Transport) AnnouncePeer(addr *net.UDPAddr, id, infoHash ID, port int, token string) (*Return, error) {
+	args := &Args{ID: id, InfoHash: &infoHash, Port: port, Token: token}
+	if port == 0 {
+		args.ImpliedPort = 1
+	}
+	return t.Query(addr, MethodAnnouncePeer, args)
+}
@@ -0,0 +1,160 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// Lookup returns the encoding of the value at path in data, or nil if
+// there is no such value or data is not valid bencode along the way.
+// Each element of path is a string, the key of a dictionary entry,
+// or an int, the index of a list element.
+//
+// Lookup does not decode data; values that do not lie on path are
+// skipped with the scanner. The result refers to data. Lookup
+// reuses its scanners, so that it usually does not allocate.
+func Lookup(data []byte, path ...interface{}) RawMessage {
+	v, _ := lookup(data, path)
+	return v
+}
+
+// LookupInt returns the integer at path in data.
+// The error names the element of path that was not found.
+func LookupInt(data []byte, path ...interface{}) (int64, error) {
+	v, err := lookup(data, path)
+	if err != nil {
+		return 0, err
+	}
+	if v[0] != 'i' {
+		return 0, errors.New("bencode: " + pathString(path) + " is not an integer")
+	}
+	i, err := strconv.ParseInt(string(v[1:len(v)-1]), 10, 64)
+	if err != nil {
+		return 0, errors.New("bencode: " + pathString(path) + " is out of range")
+	}
+	return i, nil
+}
+
+// LookupString returns the string at path in data.
+// The error names the element of path that was not found.
+func LookupString(data []byte, path ...interface{}) (string, error) {
+	v, err := lookup(data, path)
+	if err != nil {
+		return "", err
+	}
+	if v[0] < '0' || v[0] > '9' {
+		return "", errors.New("bencode: " + pathString(path) + " is not a string")
+	}
+	return string(v[bytes.IndexByte(v, ':')+1:]), nil
+}
+
+// lookupScanners holds the scanners of lookup, which would
+// otherwise allocate one, as it escapes through its step function.
+var lookupScanners = sync.Pool{
+	New: func() interface{} {
+		// Most documents are shallow enough that the scanner
+		// will not need to grow its stack while skipping values.
+		return &scanner{parseState: make([]int, 0, 16)}
+	},
+}
+
+// lookup returns the value at path in data.
+func lookup(data []byte, path []interface{}) ([]byte, error) {
+	scan := lookupScanners.Get().(*scanner)
+	defer lookupScanners.Put(scan)
+	off := 0
+	for i, elem := range path {
+		if off >= len(data) {
+			return nil, &SyntaxError{"unexpected end of bencode input", int64(off)}
+		}
+		switch elem := elem.(type) {
+		case string:
+			if data[off] != 'd' {
+				return nil, errors.New("bencode: " + pathString(path[:i]) + " is not a dictionary")
+			}
+			off++
+			for {
+				if off >= len(data) {
+					return nil, &SyntaxError{"unexpected end of bencode input", int64(off)}
+				}
+				if data[off] == 'e' {
+					return nil, errors.New("bencode: key " + strconv.Quote(elem) + " not found in " + pathString(path[:i]))
+				}
+				key, rest, err := nextValueAt(data, off, scan)
+				if err != nil {
+					return nil, err
+				}
+				if key[0] < '0' || key[0] > '9' {
+					return nil, &SyntaxError{"invalid character " + strconv.Quote(string(rune(key[0]))) + " looking for beginning of dictionary key", int64(off)}
+				}
+				off = len(data) - len(rest)
+				if string(key[bytes.IndexByte(key, ':')+1:]) == elem {
+					break
+				}
+				if _, rest, err = nextValueAt(data, off, scan); err != nil {
+					return nil, err
+				}
+				off = len(data) - len(rest)
+			}
+
+		case int:
+			if data[off] != 'l' {
+				return nil, errors.New("bencode: " + pathString(path[:i]) + " is not a list")
+			}
+			off++
+			for j := 0; ; j++ {
+				if off >= len(data) {
+					return nil, &SyntaxError{"unexpected end of bencode input", int64(off)}
+				}
+				if data[off] == 'e' {
+					return nil, errors.New("bencode: index " + strconv.Itoa(elem) + " out of range in " + pathString(path[:i]))
+				}
+				if j == elem {
+					break
+				}
+				_, rest, err := nextValueAt(data, off, scan)
+				if err != nil {
+					return nil, err
+				}
+				off = len(data) - len(rest)
+			}
+
+		default:
+			return nil, errors.New("bencode: invalid path element " + pathString(path[i:i+1]))
+		}
+	}
+	v, _, err := nextValueAt(data, off, scan)
+	return v, err
+}
+
+// nextValueAt is nextValue of data[off:], with the
+// offset of a syntax error counted from the start of data.
+func nextValueAt(data []byte, off int, scan *scanner) (value, rest []byte, err error) {
+	value, rest, err = nextValue(data[off:], scan)
+	if se, ok := err.(*SyntaxError); ok {
+		se.Offset += int64(off)
+	}
+	return
+}
+
+// pathString formats path for an error message, such as
+// info.files[3].length, as formatPath does for decoding errors.
+func pathString(path []interface{}) string {
+	if len(path) == 0 {
+		return "top-level value"
+	}
+	elems := make([]pathElem, len(path))
+	for i, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			elems[i] = pathElem{key: elem, index: -1}
+		case int:
+			elems[i] = pathElem{index: elem}
+		default:
+			elems[i] = pathElem{key: "?", index: -1}
+		}
+	}
+	return formatPath(elems)
+}
@@ -0,0 +1,354 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of the piece length chosen by Create.
+const (
+	MinPieceLength = 16 << 10
+	MaxPieceLength = 16 << 20
+)
+
+// targetPieces is the number of pieces Create aims for
+// when choosing a piece length.
+const targetPieces = 1500
+
+// CreateOptions holds the optional settings of Create.
+type CreateOptions struct {
+	// Name of the torrent, the base name of the path if empty.
+	Name string
+
+	// PieceLength is the length of a piece, a power of two.
+	// If zero, a length is chosen from the size of the content.
+	PieceLength int64
+
+	// Workers is the number of goroutines hashing pieces.
+	// If zero, runtime.NumCPU is used.
+	Workers int
+
+	// Trackers are tiers of announce URLs. The first URL is
+	// also used as the announce URL of the torrent.
+	Trackers [][]string
+
+	// WebSeeds are the BEP 19 web seed URLs.
+	WebSeeds []string
+
+	Private      bool
+	Comment      string
+	CreatedBy    string
+	CreationDate time.Time
+
+	// Pad aligns each file to the start of a piece by
+	// inserting BEP 47 padding files between them.
+	Pad bool
+
+	// Progress, if not nil, is called after each piece is
+	// hashed with the number of bytes hashed and the total.
+	// Calls are not concurrent.
+	Progress func(done, total int64)
+}
+
+// Create builds a MetaInfo for the file or directory at path.
+// Directories are walked in lexical order, and only regular
+// files are included.
+func Create(path string, opts *CreateOptions) (*MetaInfo, error) {
+	if opts == nil {
+		opts = new(CreateOptions)
+	}
+	path = filepath.Clean(path)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &Info{Name: opts.Name}
+	if info.Name == "" {
+		info.Name = filepath.Base(path)
+	}
+	if opts.Private {
+		info.Private = 1
+	}
+
+	var segs []segment
+	if !fi.IsDir() {
+		info.Length = fi.Size()
+		segs = append(segs, segment{path, fi.Size()})
+	} else {
+		if info.Files, err = walkFiles(path); err != nil {
+			return nil, err
+		}
+		if len(info.Files) == 0 {
+			return nil, fmt.Errorf("metainfo: no files in %s", path)
+		}
+	}
+
+	var total int64
+	if info.IsDir() {
+		for _, f := range info.Files {
+			total += f.Length
+		}
+	} else {
+		total = info.Length
+	}
+	if info.PieceLength = opts.PieceLength; info.PieceLength == 0 {
+		info.PieceLength = choosePieceLength(total)
+	} else if info.PieceLength < 0 || info.PieceLength&(info.PieceLength-1) != 0 {
+		return nil, fmt.Errorf("metainfo: piece length %d is not a power of two", info.PieceLength)
+	}
+
+	if info.IsDir() {
+		if opts.Pad {
+			info.Files = padFiles(info.Files, info.PieceLength)
+		}
+		for _, f := range info.Files {
+			if f.IsPadding() {
+				segs = append(segs, segment{"", f.Length})
+			} else {
+				segs = append(segs, segment{filepath.Join(append([]string{path}, f.Path...)...), f.Length})
+			}
+		}
+	}
+
+	numPieces := (info.TotalLength() + info.PieceLength - 1) / info.PieceLength
+	info.Pieces = make([]byte, numPieces*sha1.Size)
+	err = hashPieces(&contentReader{segs: segs}, info.TotalLength(), info.PieceLength, opts.Workers, opts.Progress,
+		func(i int, h [sha1.Size]byte) {
+			copy(info.Pieces[i*sha1.Size:], h[:])
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	mi := &MetaInfo{
+		Comment:   opts.Comment,
+		CreatedBy: opts.CreatedBy,
+		URLList:   opts.WebSeeds,
+	}
+	if !opts.CreationDate.IsZero() {
+		mi.CreationDate = opts.CreationDate.Unix()
+	}
+	if len(opts.Trackers) > 0 && len(opts.Trackers[0]) > 0 {
+		mi.Announce = opts.Trackers[0][0]
+		if len(opts.Trackers) > 1 || len(opts.Trackers[0]) > 1 {
+			mi.AnnounceList = opts.Trackers
+		}
+	}
+	if err = mi.SetInfo(info); err != nil {
+		return nil, err
+	}
+	return mi, nil
+}
+
+// choosePieceLength returns the power of two piece length that
+// splits total into about targetPieces pieces.
+func choosePieceLength(total int64) int64 {
+	n := int64(MinPieceLength)
+	for n < MaxPieceLength && n*targetPieces < total {
+		n <<= 1
+	}
+	return n
+}
+
+// walkFiles lists the regular files below root.
+func walkFiles(root string) (files []File, err error) {
+	err = filepath.Walk(root, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{
+			Length: fi.Size(),
+			Path:   strings.Split(filepath.ToSlash(rel), "/"),
+		})
+		return nil
+	})
+	return files, err
+}
+
+// padFiles inserts padding files so that each file
+// of files starts on a piece boundary.
+func padFiles(files []File, pieceLength int64) []File {
+	padded := make([]File, 0, 2*len(files))
+	var off int64
+	for i, f := range files {
+		padded = append(padded, f)
+		off += f.Length
+		if n := (pieceLength - off%pieceLength) % pieceLength; n > 0 && i < len(files)-1 {
+			padded = append(padded, File{
+				Length: n,
+				Path:   []string{".pad", strconv.FormatInt(n, 10)},
+				Attr:   string(AttrPadding),
+			})
+			off += n
+		}
+	}
+	return padded
+}
+
+// hashPieces reads total bytes from r and calls fn with the SHA-1
+// hash of each piece. fn is called concurrently from up to workers
+// goroutines, or runtime.NumCPU if workers is not positive.
+// Progress, if not nil, is called after each piece is hashed.
+func hashPieces(r io.Reader, total, pieceLength int64, workers int, progress func(done, total int64), fn func(i int, h [sha1.Size]byte)) error {
+	numPieces := int((total + pieceLength - 1) / pieceLength)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type job struct {
+		index int
+		buf   []byte
+	}
+	jobs := make(chan job)
+	free := make(chan []byte, 2*workers)
+	for i := 0; i < cap(free); i++ {
+		free <- make([]byte, pieceLength)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int64
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				fn(j.index, sha1.Sum(j.buf))
+				if progress != nil {
+					mu.Lock()
+					done += int64(len(j.buf))
+					progress(done, total)
+					mu.Unlock()
+				}
+				free <- j.buf[:cap(j.buf)]
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < numPieces; i++ {
+		buf := <-free
+		if rem := total - int64(i)*pieceLength; rem < pieceLength {
+			buf = buf[:rem]
+		}
+		if _, err = io.ReadFull(r, buf); err != nil {
+			break
+		}
+		jobs <- job{i, buf}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+	return err
+}
+
+// A segment is a file of the torrent content,
+// or zero padding if path is empty.
+type segment struct {
+	path   string
+	length int64
+}
+
+// contentReader reads the concatenated content of segs,
+// opening each file as it is reached.
+type contentReader struct {
+	segs []segment
+	i    int // index of the current segment
+	f    *os.File
+	open bool  // segs[i] is open
+	zero bool  // the rest of segs[i] reads as zeros
+	left int64 // bytes remaining in segs[i]
+
+	// If fail is not nil, a file that cannot be read to its
+	// full length is reported to fail and the rest of it reads
+	// as zeros. off is the offset at which reading failed,
+	// or -1 if the file could not be opened.
+	fail func(i int, off int64, err error)
+}
+
+var errChanged = errors.New("file is shorter than expected")
+
+func (r *contentReader) Read(p []byte) (n int, err error) {
+	for r.i < len(r.segs) {
+		seg := r.segs[r.i]
+		if !r.open {
+			r.open = true
+			r.zero = seg.path == ""
+			r.left = seg.length
+			if !r.zero {
+				if r.f, err = os.Open(seg.path); err != nil {
+					if r.fail == nil {
+						return 0, err
+					}
+					r.fail(r.i, -1, err)
+					r.zero = true
+					err = nil
+				}
+			}
+		}
+		if r.left == 0 {
+			r.Close()
+			r.i++
+			continue
+		}
+
+		if int64(len(p)) > r.left {
+			p = p[:r.left]
+		}
+		if r.zero {
+			for i := range p {
+				p[i] = 0
+			}
+			n = len(p)
+		} else {
+			n, err = r.f.Read(p)
+			if err == io.EOF {
+				err = nil
+				if int64(n) < r.left {
+					err = &os.PathError{Op: "read", Path: seg.path, Err: errChanged}
+				}
+			}
+			if err != nil && r.fail != nil {
+				r.fail(r.i, seg.length-r.left+int64(n), err)
+				r.zero = true
+				err = nil
+			}
+		}
+		r.left -= int64(n)
+		return n, err
+	}
+	return 0, io.EOF
+}
+
+// Close closes the current file, if any.
+func (r *contentReader) Close() error {
+	r.open = false
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,174 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+var createFiles = []struct {
+	path string
+	size int
+}{
+	{"a", 40000},
+	{"b/c", 1},
+	{"b/d", 0},
+	{"b/e", 70000},
+	{"f", 16384},
+}
+
+func writeTestFiles(t *testing.T) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "content")
+	for i, f := range createFiles {
+		data := make([]byte, f.size)
+		for j := range data {
+			data[j] = byte(i + j*13)
+		}
+		name := filepath.Join(root, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// testPieces hashes the content of info read sequentially from root.
+func testPieces(t *testing.T, root string, info *Info) []byte {
+	var content []byte
+	for _, f := range info.FileList() {
+		if f.IsPadding() {
+			content = append(content, make([]byte, f.Length)...)
+			continue
+		}
+		name := root
+		if info.IsDir() {
+			name = filepath.Join(append([]string{root}, f.Path...)...)
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content = append(content, data...)
+	}
+	var pieces []byte
+	for len(content) > 0 {
+		n := int(info.PieceLength)
+		if n > len(content) {
+			n = len(content)
+		}
+		h := sha1.Sum(content[:n])
+		pieces = append(pieces, h[:]...)
+		content = content[n:]
+	}
+	return pieces
+}
+
+func TestCreate(t *testing.T) {
+	root := writeTestFiles(t)
+
+	for _, pad := range []bool{false, true} {
+		var last, total int64
+		opts := &CreateOptions{
+			PieceLength:  MinPieceLength,
+			Workers:      3,
+			Trackers:     [][]string{{"http://a/announce"}, {"http://b/announce"}},
+			WebSeeds:     []string{"http://seed/"},
+			Private:      true,
+			Comment:      "comment",
+			CreationDate: time.Unix(1400000000, 0),
+			Pad:          pad,
+			Progress: func(done, n int64) {
+				if done < last {
+					t.Errorf("progress went backwards from %d to %d", last, done)
+				}
+				last, total = done, n
+			},
+		}
+		mi, err := Create(root, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := mi.UnmarshalInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Name != "content" || !info.IsPrivate() || info.PieceLength != MinPieceLength {
+			t.Errorf("pad %v: got info %+v", pad, info)
+		}
+		if last != total || total != info.TotalLength() {
+			t.Errorf("pad %v: progress ended at %d of %d, want %d", pad, last, total, info.TotalLength())
+		}
+		if mi.Announce != "http://a/announce" || len(mi.AnnounceList) != 2 || mi.CreationDate != 1400000000 {
+			t.Errorf("pad %v: got %+v", pad, mi)
+		}
+		if !bytes.Equal(info.Pieces, testPieces(t, root, info)) {
+			t.Errorf("pad %v: piece hashes do not match content", pad)
+		}
+
+		var paths []string
+		var off int64
+		for _, f := range info.Files {
+			if !f.IsPadding() {
+				paths = append(paths, filepath.ToSlash(filepath.Join(f.Path...)))
+				if pad && off%info.PieceLength != 0 {
+					t.Errorf("pad %v: %q starts at %d", pad, f.Path, off)
+				}
+			}
+			off += f.Length
+		}
+		if want := []string{"a", "b/c", "b/d", "b/e", "f"}; !reflect.DeepEqual(paths, want) {
+			t.Errorf("pad %v: got files %q, want %q", pad, paths, want)
+		}
+
+		var buf bytes.Buffer
+		if err = mi.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if err = bencode.ValidCanonical(buf.Bytes()); err != nil {
+			t.Errorf("pad %v: not canonical: %s", pad, err)
+		}
+	}
+}
+
+func TestCreateFile(t *testing.T) {
+	root := writeTestFiles(t)
+	mi, err := Create(filepath.Join(root, "b", "e"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.IsDir() || info.Name != "e" || info.Length != 70000 {
+		t.Errorf("got info %+v", info)
+	}
+	if !bytes.Equal(info.Pieces, testPieces(t, filepath.Join(root, "b", "e"), info)) {
+		t.Error("piece hashes do not match content")
+	}
+}
+
+func TestChoosePieceLength(t *testing.T) {
+	for _, tt := range []struct{ total, want int64 }{
+		{0, MinPieceLength},
+		{1 << 20, MinPieceLength},
+		{1 << 30, 1 << 20},
+		{1 << 40, MaxPieceLength},
+	} {
+		if got := choosePieceLength(tt.total); got != tt.want {
+			t.Errorf("choosePieceLength(%d) = %d, want %d", tt.total, got, tt.want)
+		}
+	}
+}
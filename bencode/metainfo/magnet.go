@@ -0,0 +1,287 @@
+package metainfo
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A Magnet is a magnet link, as described by BEP 9,
+// with the v2 info-hash of BEP 52 and the select-only
+// parameter of BEP 53.
+type Magnet struct {
+	InfoHash    *Hash   // xt=urn:btih
+	InfoHashV2  *HashV2 // xt=urn:btmh
+	DisplayName string  // dn
+	Trackers    []string
+	WebSeeds    []string
+
+	// SelectOnly lists the indices of the files to download, in
+	// increasing order. It is empty if all files are selected.
+	SelectOnly []int
+
+	// Params holds any other parameters of the link.
+	Params url.Values
+}
+
+const (
+	btihPrefix = "urn:btih:"
+	btmhPrefix = "urn:btmh:"
+
+	// multihash prefix of a SHA-256 hash.
+	sha256Multihash = "1220"
+)
+
+// Magnet returns a magnet link for mi, with the info-hashes
+// and name of its info dictionary, its trackers and web seeds.
+func (mi *MetaInfo) Magnet() (*Magnet, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, err
+	}
+	m := &Magnet{
+		DisplayName: info.Name,
+		WebSeeds:    mi.URLList,
+	}
+	if info.IsV1() || !info.IsV2() {
+		h := mi.InfoHash()
+		m.InfoHash = &h
+	}
+	if info.IsV2() {
+		h := mi.InfoHashV2()
+		m.InfoHashV2 = &h
+	}
+	for _, tier := range mi.Trackers() {
+		m.Trackers = append(m.Trackers, tier...)
+	}
+	return m, nil
+}
+
+// String returns m as a magnet URI.
+func (m *Magnet) String() string {
+	var params []string
+	add := func(key, value string) {
+		params = append(params, key+"="+url.QueryEscape(value))
+	}
+	if m.InfoHash != nil {
+		params = append(params, "xt="+btihPrefix+m.InfoHash.String())
+	}
+	if m.InfoHashV2 != nil {
+		params = append(params, "xt="+btmhPrefix+sha256Multihash+m.InfoHashV2.String())
+	}
+	if m.DisplayName != "" {
+		add("dn", m.DisplayName)
+	}
+	for _, tr := range m.Trackers {
+		add("tr", tr)
+	}
+	for _, ws := range m.WebSeeds {
+		add("ws", ws)
+	}
+	if len(m.SelectOnly) > 0 {
+		params = append(params, "so="+formatRanges(m.SelectOnly))
+	}
+
+	keys := make([]string, 0, len(m.Params))
+	for k := range m.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range m.Params[k] {
+			params = append(params, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// ParseMagnet parses a magnet URI. Info-hashes may be in hexadecimal
+// or base32 form, and at least one info-hash must be present.
+func ParseMagnet(uri string) (*Magnet, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "magnet" {
+		return nil, fmt.Errorf("metainfo: not a magnet link: %q", uri)
+	}
+	pairs, err := parseQuery(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parameters are handled in order, so that trackers keep the
+	// order of the link. Of single-valued parameters, the first counts.
+	m := new(Magnet)
+	var haveName, haveSelect bool
+	for _, p := range pairs {
+		key, value := p[0], p[1]
+		switch {
+		case key == "xt":
+			if err = m.parseExactTopic(value); err != nil {
+				return nil, err
+			}
+		case key == "dn":
+			if !haveName {
+				m.DisplayName, haveName = value, true
+			}
+		case key == "tr" || strings.HasPrefix(key, "tr."):
+			m.Trackers = append(m.Trackers, value)
+		case key == "ws":
+			m.WebSeeds = append(m.WebSeeds, value)
+		case key == "so":
+			if !haveSelect {
+				if m.SelectOnly, err = parseRanges(value); err != nil {
+					return nil, err
+				}
+				haveSelect = true
+			}
+		default:
+			if m.Params == nil {
+				m.Params = make(url.Values)
+			}
+			m.Params.Add(key, value)
+		}
+	}
+	if m.InfoHash == nil && m.InfoHashV2 == nil {
+		return nil, errors.New("metainfo: magnet link has no info-hash")
+	}
+	return m, nil
+}
+
+// parseQuery is like url.ParseQuery, but returns
+// the key and value pairs in the order of the query.
+func parseQuery(query string) (pairs [][2]string, err error) {
+	for query != "" {
+		var pair string
+		if i := strings.IndexByte(query, '&'); i >= 0 {
+			pair, query = query[:i], query[i+1:]
+		} else {
+			pair, query = query, ""
+		}
+		if pair == "" {
+			continue
+		}
+		if strings.Contains(pair, ";") {
+			return nil, errors.New("metainfo: invalid semicolon separator in magnet link")
+		}
+		key, value := pair, ""
+		if i := strings.IndexByte(pair, '='); i >= 0 {
+			key, value = pair[:i], pair[i+1:]
+		}
+		if key, err = url.QueryUnescape(key); err != nil {
+			return nil, err
+		}
+		if value, err = url.QueryUnescape(value); err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+	return pairs, nil
+}
+
+// parseExactTopic parses an xt parameter. Topics other
+// than BitTorrent info-hashes are kept in m.Params.
+func (m *Magnet) parseExactTopic(xt string) error {
+	switch {
+	case strings.HasPrefix(xt, btihPrefix):
+		s := xt[len(btihPrefix):]
+		var h Hash
+		var err error
+		switch len(s) {
+		case 2 * len(h):
+			_, err = hex.Decode(h[:], []byte(s))
+		case base32.StdEncoding.EncodedLen(len(h)):
+			_, err = base32.StdEncoding.Decode(h[:], []byte(strings.ToUpper(s)))
+		default:
+			err = errors.New("bad length")
+		}
+		if err != nil {
+			return fmt.Errorf("metainfo: invalid magnet info-hash %q: %s", s, err)
+		}
+		m.InfoHash = &h
+
+	case strings.HasPrefix(xt, btmhPrefix):
+		s := xt[len(btmhPrefix):]
+		var h HashV2
+		if !strings.HasPrefix(s, sha256Multihash) || len(s) != len(sha256Multihash)+2*len(h) {
+			return fmt.Errorf("metainfo: unsupported magnet multihash %q", s)
+		}
+		if _, err := hex.Decode(h[:], []byte(s[len(sha256Multihash):])); err != nil {
+			return fmt.Errorf("metainfo: invalid magnet multihash %q: %s", s, err)
+		}
+		m.InfoHashV2 = &h
+
+	default:
+		if m.Params == nil {
+			m.Params = make(url.Values)
+		}
+		m.Params.Add("xt", xt)
+	}
+	return nil
+}
+
+// formatRanges formats increasing indices as a
+// comma separated list of indices and ranges.
+func formatRanges(indices []int) string {
+	var b []byte
+	for i := 0; i < len(indices); {
+		j := i
+		for j+1 < len(indices) && indices[j+1] == indices[j]+1 {
+			j++
+		}
+		if len(b) > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendInt(b, int64(indices[i]), 10)
+		if j > i {
+			b = append(b, '-')
+			b = strconv.AppendInt(b, int64(indices[j]), 10)
+		}
+		i = j + 1
+	}
+	return string(b)
+}
+
+// maxSelectOnly limits the number of indices a select-only
+// parameter may expand to.
+const maxSelectOnly = 1 << 20
+
+// parseRanges parses a list formatted by formatRanges.
+func parseRanges(s string) (indices []int, err error) {
+	for _, r := range strings.Split(s, ",") {
+		first, last := r, r
+		if i := strings.IndexByte(r, '-'); i >= 0 {
+			first, last = r[:i], r[i+1:]
+		}
+		a, err := strconv.Atoi(first)
+		if err != nil {
+			return nil, fmt.Errorf("metainfo: invalid magnet select-only %q", s)
+		}
+		b, err := strconv.Atoi(last)
+		// Compare without adding, which could overflow.
+		if err != nil || a < 0 || b < a || b-a >= maxSelectOnly-len(indices) {
+			return nil, fmt.Errorf("metainfo: invalid magnet select-only %q", s)
+		}
+		for i := a; ; i++ {
+			indices = append(indices, i)
+			if i == b {
+				break
+			}
+		}
+	}
+	sort.Ints(indices)
+	n := 0
+	for i, x := range indices {
+		if i == 0 || x != indices[n-1] {
+			indices[n] = x
+			n++
+		}
+	}
+	return indices[:n], nil
+}
@@ -0,0 +1,94 @@
+package metainfo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMagnet(t *testing.T) {
+	mi, err := Load(strings.NewReader(testTorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := mi.Magnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SelectOnly = []int{0, 2, 3, 4, 7}
+
+	uri := m.String()
+	h := mi.InfoHash()
+	want := "magnet:?xt=urn:btih:" + h.String() + "&dn=dir" +
+		"&tr=http%3A%2F%2Ftracker%2Fann&tr=udp%3A%2F%2Fbackup%2F" +
+		"&ws=http%3A%2F%2Fseed%2Fdir%2F&so=0,2-4,7"
+	if uri != want {
+		t.Errorf("got  %s\nwant %s", uri, want)
+	}
+
+	m2, err := ParseMagnet(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("ParseMagnet: got %+v, want %+v", m2, m)
+	}
+}
+
+func TestMagnetV2(t *testing.T) {
+	mi, _ := testV2Torrent(t)
+	m, err := mi.Magnet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.InfoHash != nil || m.InfoHashV2 == nil || *m.InfoHashV2 != mi.InfoHashV2() {
+		t.Fatalf("got %+v", m)
+	}
+	uri := m.String()
+	if !strings.HasPrefix(uri, "magnet:?xt=urn:btmh:1220"+mi.InfoHashV2().String()) {
+		t.Errorf("got %s", uri)
+	}
+	m2, err := ParseMagnet(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(m2, m) {
+		t.Errorf("ParseMagnet: got %+v, want %+v", m2, m)
+	}
+}
+
+func TestParseMagnet(t *testing.T) {
+	// The same info-hash in hex and base32.
+	const hexHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+	for _, uri := range []string{
+		"magnet:?xt=urn:btih:" + hexHash + "&dn=name&tr.1=http://a&tr.2=http://b&x.pe=1.2.3.4:5",
+		"magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK&dn=name&tr=http://a&tr=http://b&x.pe=1.2.3.4:5",
+		"magnet:?tr=http://a&dn=name&x.pe=1.2.3.4:5&tr.3=http://b&xt=urn:btih:" + hexHash + "&dn=other",
+	} {
+		m, err := ParseMagnet(uri)
+		if err != nil {
+			t.Errorf("%s: %s", uri, err)
+			continue
+		}
+		if m.InfoHash == nil || m.InfoHash.String() != hexHash {
+			t.Errorf("%s: got info-hash %v", uri, m.InfoHash)
+		}
+		if m.DisplayName != "name" || !reflect.DeepEqual(m.Trackers, []string{"http://a", "http://b"}) || m.Params.Get("x.pe") != "1.2.3.4:5" {
+			t.Errorf("%s: got %+v", uri, m)
+		}
+	}
+
+	for _, uri := range []string{
+		"http://example/?xt=urn:btih:" + hexHash,
+		"magnet:?dn=name",
+		"magnet:?xt=urn:btih:1234",
+		"magnet:?xt=urn:btmh:1114" + hexHash,
+		"magnet:?xt=urn:btih:" + hexHash + "&so=3-1",
+		"magnet:?xt=urn:btih:" + hexHash + "&so=5,0-9223372036854775807",
+		"magnet:?xt=urn:btih:" + hexHash + "&so=9223372036854775807-9223372036854775807,0-1048575",
+	} {
+		if m, err := ParseMagnet(uri); err == nil {
+			t.Errorf("%s: got %+v", uri, m)
+		}
+	}
+}
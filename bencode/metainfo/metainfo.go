@@ -0,0 +1,226 @@
+// Package metainfo implements the .torrent metainfo file format
+// of BEP 3, with the announce-list of BEP 12, the url-list of
+// BEP 19, the padding files and attributes of BEP 47 and the
+// file tree and piece layers of BitTorrent v2, BEP 52.
+package metainfo
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// MetaInfo is the top level dictionary of a .torrent file.
+//
+// The info dictionary is kept in its original encoding so
+// that the info-hash is computed over the bytes as they
+// were received, whether or not they are canonical.
+type MetaInfo struct {
+	InfoBytes    bencode.RawMessage `bencode:"info"`
+	Announce     string             `bencode:"announce,omitempty"`
+	AnnounceList [][]string         `bencode:"announce-list,omitempty"`
+	URLList      URLList            `bencode:"url-list,omitempty"`
+	Comment      string             `bencode:"comment,omitempty"`
+	CreatedBy    string             `bencode:"created by,omitempty"`
+	CreationDate int64              `bencode:"creation date,omitempty"`
+	Encoding     string             `bencode:"encoding,omitempty"`
+
+	// PieceLayers maps the pieces root of each v2 file larger
+	// than a piece to the concatenated hashes of its pieces.
+	PieceLayers map[string][]byte `bencode:"piece layers,omitempty"`
+}
+
+// Load reads a MetaInfo from r.
+func Load(r io.Reader) (*MetaInfo, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	mi := new(MetaInfo)
+	if err = bencode.Unmarshal(b, mi); err != nil {
+		return nil, err
+	}
+	if len(mi.InfoBytes) == 0 {
+		return nil, ErrNoInfo
+	}
+	return mi, nil
+}
+
+// Write writes the bencoding of mi to w.
+func (mi *MetaInfo) Write(w io.Writer) error {
+	return bencode.NewEncoder(w).Encode(mi)
+}
+
+// ErrNoInfo is returned when a metainfo file has no info dictionary.
+var ErrNoInfo = errors.New("metainfo: missing info dictionary")
+
+// InfoHash returns the SHA-1 hash of the raw info dictionary.
+func (mi *MetaInfo) InfoHash() (h Hash) {
+	return sha1.Sum(mi.InfoBytes)
+}
+
+// UnmarshalInfo decodes the info dictionary.
+func (mi *MetaInfo) UnmarshalInfo() (*Info, error) {
+	if len(mi.InfoBytes) == 0 {
+		return nil, ErrNoInfo
+	}
+	info := new(Info)
+	if err := bencode.Unmarshal(mi.InfoBytes, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// SetInfo replaces the info dictionary with the encoding of info.
+func (mi *MetaInfo) SetInfo(info *Info) error {
+	b, err := bencode.Marshal(info)
+	if err != nil {
+		return err
+	}
+	mi.InfoBytes = b
+	return nil
+}
+
+// Trackers returns the tiers of tracker URLs, taken from the
+// announce-list if present, and otherwise from announce.
+func (mi *MetaInfo) Trackers() [][]string {
+	if len(mi.AnnounceList) > 0 {
+		return mi.AnnounceList
+	}
+	if mi.Announce != "" {
+		return [][]string{{mi.Announce}}
+	}
+	return nil
+}
+
+// Info is the info dictionary of a .torrent file.
+//
+// A single file torrent has a Length and no Files,
+// a multiple file torrent has Files and a zero Length.
+type Info struct {
+	Name        string   `bencode:"name"`
+	PieceLength int64    `bencode:"piece length"`
+	Pieces      []byte   `bencode:"pieces,omitempty"`
+	Private     int64    `bencode:"private,omitempty"`
+	Source      string   `bencode:"source,omitempty"`
+	Length      int64    `bencode:"length,omitempty"`
+	Files       []File   `bencode:"files,omitempty"`
+	Attr        string   `bencode:"attr,omitempty"`
+	SHA1        []byte   `bencode:"sha1,omitempty"`
+	SymlinkPath []string `bencode:"symlink path,omitempty"`
+
+	MetaVersion int64     `bencode:"meta version,omitempty"`
+	FileTree    *FileTree `bencode:"file tree,omitempty"`
+}
+
+// IsPrivate reports whether the torrent is flagged as private.
+func (info *Info) IsPrivate() bool { return info.Private != 0 }
+
+// IsDir reports whether info describes a multiple file torrent.
+func (info *Info) IsDir() bool { return len(info.Files) != 0 }
+
+// TotalLength returns the length of the torrent content,
+// including any padding files.
+func (info *Info) TotalLength() (n int64) {
+	if !info.IsDir() {
+		return info.Length
+	}
+	for _, f := range info.Files {
+		n += f.Length
+	}
+	return n
+}
+
+// NumPieces returns the number of piece hashes in info.
+func (info *Info) NumPieces() int { return len(info.Pieces) / sha1.Size }
+
+// Piece returns the SHA-1 hash of piece i.
+func (info *Info) Piece(i int) []byte {
+	return info.Pieces[i*sha1.Size : (i+1)*sha1.Size]
+}
+
+// FileList returns the files of info. A single file torrent
+// is returned as one file, with the torrent name as its path.
+func (info *Info) FileList() []File {
+	if info.IsDir() {
+		return info.Files
+	}
+	return []File{{
+		Length:      info.Length,
+		Path:        []string{info.Name},
+		Attr:        info.Attr,
+		SHA1:        info.SHA1,
+		SymlinkPath: info.SymlinkPath,
+	}}
+}
+
+// A File is an entry in the files list of a multiple file torrent.
+type File struct {
+	Length      int64    `bencode:"length"`
+	Path        []string `bencode:"path"`
+	Attr        string   `bencode:"attr,omitempty"`
+	SHA1        []byte   `bencode:"sha1,omitempty"`
+	SymlinkPath []string `bencode:"symlink path,omitempty"`
+}
+
+// File attributes, as defined by BEP 47.
+const (
+	AttrPadding    = 'p'
+	AttrExecutable = 'x'
+	AttrHidden     = 'h'
+	AttrSymlink    = 'l'
+)
+
+// HasAttr reports whether the file has the attribute a.
+func (f *File) HasAttr(a byte) bool {
+	for i := 0; i < len(f.Attr); i++ {
+		if f.Attr[i] == a {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPadding reports whether f is a BEP 47 padding file.
+func (f *File) IsPadding() bool { return f.HasAttr(AttrPadding) }
+
+// Hash is a v1 info-hash.
+type Hash [sha1.Size]byte
+
+// String returns h in hexadecimal.
+func (h Hash) String() string { return hex.EncodeToString(h[:]) }
+
+// URLList is the list of web seeds of BEP 19, which
+// may be encoded as a single string or a list of strings.
+type URLList []string
+
+// MarshalBencode encodes l as a list of strings.
+func (l URLList) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal([]string(l))
+}
+
+// UnmarshalBencode decodes either a single string or a list of strings.
+func (l *URLList) UnmarshalBencode(b []byte) error {
+	if len(b) > 0 && b[0] == 'l' {
+		var s []string
+		if err := bencode.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		*l = s
+		return nil
+	}
+	var s string
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	if s == "" {
+		*l = nil
+	} else {
+		*l = URLList{s}
+	}
+	return nil
+}
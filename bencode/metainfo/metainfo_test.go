@@ -0,0 +1,105 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// The info dictionary of this torrent has an unknown key
+// that would be lost by decoding and encoding it again.
+const testTorrent = "d8:announce18:http://tracker/ann13:announce-listll18:http://tracker/annel13:udp://backup/ee" +
+	"7:comment4:test10:created by4:test13:creation datei1400000000e" +
+	"4:infod5:filesld6:lengthi5e4:pathl1:aeed4:attr1:p6:lengthi11e4:pathl4:.pad2:11eed6:lengthi3e4:pathl3:dir1:beee" +
+	"4:name3:dir12:piece lengthi16e6:pieces20:aaaaaaaaaaaaaaaaaaaa5:zzzzzi1ee" +
+	"8:url-list16:http://seed/dir/e"
+
+func TestLoad(t *testing.T) {
+	mi, err := Load(strings.NewReader(testTorrent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"http://tracker/ann"}, {"udp://backup/"}}; !reflect.DeepEqual(mi.Trackers(), want) {
+		t.Errorf("Trackers: got %q, want %q", mi.Trackers(), want)
+	}
+	if want := (URLList{"http://seed/dir/"}); !reflect.DeepEqual(mi.URLList, want) {
+		t.Errorf("URLList: got %q, want %q", mi.URLList, want)
+	}
+	if mi.CreationDate != 1400000000 {
+		t.Errorf("CreationDate: got %d", mi.CreationDate)
+	}
+
+	i := strings.Index(testTorrent, "4:info") + 6
+	j := strings.Index(testTorrent, "8:url-list")
+	if want := Hash(sha1.Sum([]byte(testTorrent[i:j]))); mi.InfoHash() != want {
+		t.Errorf("InfoHash: got %s, want %s", mi.InfoHash(), want)
+	}
+
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() || info.Name != "dir" || info.PieceLength != 16 || info.NumPieces() != 1 {
+		t.Errorf("got info %+v", info)
+	}
+	if info.TotalLength() != 19 {
+		t.Errorf("TotalLength: got %d, want 19", info.TotalLength())
+	}
+	if files := info.FileList(); len(files) != 3 || !files[1].IsPadding() || files[2].IsPadding() {
+		t.Errorf("got files %+v", files)
+	}
+
+	var buf bytes.Buffer
+	if err = mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi2.InfoHash() != mi.InfoHash() {
+		t.Errorf("InfoHash changed after Write")
+	}
+	if !reflect.DeepEqual(mi2, mi) {
+		t.Errorf("Load after Write: got %+v, want %+v", mi2, mi)
+	}
+}
+
+func TestSetInfo(t *testing.T) {
+	info := &Info{
+		Name:        "file",
+		PieceLength: 1 << 18,
+		Pieces:      make([]byte, 40),
+		Length:      300000,
+	}
+	var mi MetaInfo
+	if err := mi.SetInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, info) {
+		t.Errorf("got %+v, want %+v", got, info)
+	}
+	if files := got.FileList(); len(files) != 1 || files[0].Path[0] != "file" || files[0].Length != 300000 {
+		t.Errorf("got files %+v", files)
+	}
+}
+
+func TestURLList(t *testing.T) {
+	var mi MetaInfo
+	in := "d4:infode8:url-listl4:http5:otheree"
+	if err := bencode.Unmarshal([]byte(in), &mi); err != nil {
+		t.Fatal(err)
+	}
+	if want := (URLList{"http", "other"}); !reflect.DeepEqual(mi.URLList, want) {
+		t.Errorf("got %q, want %q", mi.URLList, want)
+	}
+}
@@ -0,0 +1,234 @@
+package metainfo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// BlockSize is the size of the data blocks hashed
+// into the leaves of a BEP 52 merkle tree.
+const BlockSize = 16 << 10
+
+// HashV2 is a v2 info-hash, the SHA-256 hash of the info dictionary.
+type HashV2 [sha256.Size]byte
+
+// String returns h in hexadecimal.
+func (h HashV2) String() string { return hex.EncodeToString(h[:]) }
+
+// Truncated returns h truncated to the length of a v1 info-hash,
+// as used by trackers and the DHT.
+func (h HashV2) Truncated() (t Hash) {
+	copy(t[:], h[:])
+	return t
+}
+
+// InfoHashV2 returns the SHA-256 hash of the raw info dictionary.
+func (mi *MetaInfo) InfoHashV2() HashV2 {
+	return sha256.Sum256(mi.InfoBytes)
+}
+
+// IsV1 reports whether info has v1 piece hashes.
+func (info *Info) IsV1() bool { return len(info.Pieces) != 0 }
+
+// IsV2 reports whether info has a v2 file tree.
+func (info *Info) IsV2() bool { return info.MetaVersion == 2 && info.FileTree != nil }
+
+// IsHybrid reports whether info describes both a v1 and a v2 torrent.
+func (info *Info) IsHybrid() bool { return info.IsV1() && info.IsV2() }
+
+// A FileTree is a node of the v2 file tree, either a directory
+// of named entries or a file.
+//
+// In its bencoding a file is a dictionary with a single empty
+// key, holding the length and pieces root of the file.
+type FileTree struct {
+	Dir  map[string]*FileTree
+	File *FileEntry
+}
+
+// A FileEntry describes a file of the v2 file tree.
+// Empty files have no pieces root.
+type FileEntry struct {
+	Length     int64  `bencode:"length"`
+	PiecesRoot []byte `bencode:"pieces root,omitempty"`
+}
+
+// A FileV2 is a file of the v2 file tree with its full path.
+type FileV2 struct {
+	Path []string
+	FileEntry
+}
+
+// MarshalBencode encodes t as a nested dictionary.
+func (t FileTree) MarshalBencode() ([]byte, error) {
+	if t.File != nil {
+		return bencode.Marshal(map[string]*FileEntry{"": t.File})
+	}
+	if t.Dir == nil {
+		return []byte("de"), nil
+	}
+	return bencode.Marshal(t.Dir)
+}
+
+// UnmarshalBencode decodes a nested file tree dictionary.
+func (t *FileTree) UnmarshalBencode(b []byte) error {
+	var m map[string]bencode.RawMessage
+	if err := bencode.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	*t = FileTree{}
+	if raw, ok := m[""]; ok {
+		if len(m) != 1 {
+			return errors.New("metainfo: file tree entry is both a file and a directory")
+		}
+		t.File = new(FileEntry)
+		return bencode.Unmarshal(raw, t.File)
+	}
+
+	t.Dir = make(map[string]*FileTree, len(m))
+	for name, raw := range m {
+		sub := new(FileTree)
+		if err := sub.UnmarshalBencode(raw); err != nil {
+			return err
+		}
+		t.Dir[name] = sub
+	}
+	return nil
+}
+
+// Lookup returns the file at path, or nil if there is none.
+func (t *FileTree) Lookup(path ...string) *FileEntry {
+	for _, name := range path {
+		if t = t.Dir[name]; t == nil {
+			return nil
+		}
+	}
+	return t.File
+}
+
+// Walk calls fn for each file in the tree, in path order.
+// If fn returns an error the walk stops and the error is returned.
+func (t *FileTree) Walk(fn func(path []string, f *FileEntry) error) error {
+	return t.walk(nil, fn)
+}
+
+func (t *FileTree) walk(path []string, fn func([]string, *FileEntry) error) error {
+	if t.File != nil {
+		return fn(path, t.File)
+	}
+	names := make([]string, 0, len(t.Dir))
+	for name := range t.Dir {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub := append(path[:len(path):len(path)], name)
+		if err := t.Dir[name].walk(sub, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Files returns the files of the tree, in path order.
+func (t *FileTree) Files() (files []FileV2) {
+	t.Walk(func(path []string, f *FileEntry) error {
+		files = append(files, FileV2{path, *f})
+		return nil
+	})
+	return files
+}
+
+// hashPair returns the parent of two merkle tree nodes.
+func hashPair(a, b [sha256.Size]byte) [sha256.Size]byte {
+	var buf [2 * sha256.Size]byte
+	copy(buf[:], a[:])
+	copy(buf[sha256.Size:], b[:])
+	return sha256.Sum256(buf[:])
+}
+
+// padHash returns the root of a merkle subtree of
+// zero leaf hashes spanning n bytes of blocks.
+func padHash(n int64) (h [sha256.Size]byte) {
+	for ; n > BlockSize; n >>= 1 {
+		h = hashPair(h, h)
+	}
+	return h
+}
+
+// merkleRoot returns the root of the tree with the given layer,
+// padded to a power of two width with pad.
+func merkleRoot(layer [][sha256.Size]byte, pad [sha256.Size]byte) [sha256.Size]byte {
+	n := 1
+	for n < len(layer) {
+		n <<= 1
+	}
+	h := make([][sha256.Size]byte, n)
+	copy(h, layer)
+	for i := len(layer); i < n; i++ {
+		h[i] = pad
+	}
+	for len(h) > 1 {
+		for i := 0; i < len(h)/2; i++ {
+			h[i] = hashPair(h[2*i], h[2*i+1])
+		}
+		h = h[:len(h)/2]
+	}
+	return h[0]
+}
+
+// PieceLayerRoot returns the merkle root of a piece layer,
+// the concatenated hashes of pieces of length pieceLength.
+func PieceLayerRoot(layer []byte, pieceLength int64) ([sha256.Size]byte, error) {
+	if len(layer) == 0 || len(layer)%sha256.Size != 0 {
+		return [sha256.Size]byte{}, fmt.Errorf("metainfo: invalid piece layer length %d", len(layer))
+	}
+	hashes := make([][sha256.Size]byte, len(layer)/sha256.Size)
+	for i := range hashes {
+		copy(hashes[i][:], layer[i*sha256.Size:])
+	}
+	return merkleRoot(hashes, padHash(pieceLength)), nil
+}
+
+// VerifyPieceLayers checks that every file of info larger than
+// a piece has a piece layer in mi, with the expected number of
+// hashes and a merkle root matching the pieces root of the file.
+func (mi *MetaInfo) VerifyPieceLayers(info *Info) error {
+	if !info.IsV2() {
+		return errors.New("metainfo: not a v2 torrent")
+	}
+	if info.PieceLength < BlockSize || info.PieceLength&(info.PieceLength-1) != 0 {
+		return fmt.Errorf("metainfo: invalid v2 piece length %d", info.PieceLength)
+	}
+
+	return info.FileTree.Walk(func(path []string, f *FileEntry) error {
+		if f.Length <= info.PieceLength {
+			return nil
+		}
+		name := strings.Join(path, "/")
+		if len(f.PiecesRoot) != sha256.Size {
+			return fmt.Errorf("metainfo: %s: invalid pieces root", name)
+		}
+		layer, ok := mi.PieceLayers[string(f.PiecesRoot)]
+		if !ok {
+			return fmt.Errorf("metainfo: %s: missing piece layer", name)
+		}
+		if n := (f.Length + info.PieceLength - 1) / info.PieceLength; int64(len(layer)) != n*sha256.Size {
+			return fmt.Errorf("metainfo: %s: piece layer has %d bytes, want %d hashes", name, len(layer), n)
+		}
+		root, err := PieceLayerRoot(layer, info.PieceLength)
+		if err != nil {
+			return err
+		}
+		if string(root[:]) != string(f.PiecesRoot) {
+			return fmt.Errorf("metainfo: %s: piece layer does not match pieces root", name)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,151 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"reflect"
+	"testing"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// treeRoot hashes data into 16 KiB leaves and returns the root
+// of the tree of width leaves, padded with zero hashes.
+func treeRoot(data []byte, width int) []byte {
+	layer := make([][]byte, width)
+	for i := range layer {
+		if off := i * BlockSize; off < len(data) {
+			end := off + BlockSize
+			if end > len(data) {
+				end = len(data)
+			}
+			h := sha256.Sum256(data[off:end])
+			layer[i] = h[:]
+		} else {
+			layer[i] = make([]byte, sha256.Size)
+		}
+	}
+	for len(layer) > 1 {
+		next := make([][]byte, len(layer)/2)
+		for i := range next {
+			h := sha256.Sum256(append(append([]byte{}, layer[2*i]...), layer[2*i+1]...))
+			next[i] = h[:]
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+func testV2Torrent(t *testing.T) (*MetaInfo, *Info) {
+	const pieceLength = 2 * BlockSize
+
+	big := make([]byte, 6*BlockSize+6000)
+	for i := range big {
+		big[i] = byte(i * 7)
+	}
+	small := []byte("small file")
+
+	// The big file has four pieces of two blocks each.
+	var layer []byte
+	for i := 0; i < 4; i++ {
+		end := (i + 1) * pieceLength
+		if end > len(big) {
+			end = len(big)
+		}
+		layer = append(layer, treeRoot(big[i*pieceLength:end], 2)...)
+	}
+	bigRoot := treeRoot(big, 8)
+
+	info := &Info{
+		Name:        "dir",
+		PieceLength: pieceLength,
+		MetaVersion: 2,
+		FileTree: &FileTree{Dir: map[string]*FileTree{
+			"big": {File: &FileEntry{Length: int64(len(big)), PiecesRoot: bigRoot}},
+			"sub": {Dir: map[string]*FileTree{
+				"small": {File: &FileEntry{Length: int64(len(small)), PiecesRoot: treeRoot(small, 1)}},
+				"empty": {File: &FileEntry{}},
+			}},
+		}},
+	}
+	mi := &MetaInfo{PieceLayers: map[string][]byte{string(bigRoot): layer}}
+	if err := mi.SetInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	return mi, info
+}
+
+func TestFileTree(t *testing.T) {
+	mi, info := testV2Torrent(t)
+
+	var buf bytes.Buffer
+	if err := mi.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := bencode.ValidCanonical(buf.Bytes()); err != nil {
+		t.Errorf("encoding is not canonical: %s", err)
+	}
+	mi2, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info2, err := mi2.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(info2, info) {
+		t.Errorf("got %+v, want %+v", info2, info)
+	}
+	if !info2.IsV2() || info2.IsV1() || info2.IsHybrid() {
+		t.Errorf("IsV2 %v, IsV1 %v, IsHybrid %v", info2.IsV2(), info2.IsV1(), info2.IsHybrid())
+	}
+
+	var paths [][]string
+	for _, f := range info2.FileTree.Files() {
+		paths = append(paths, f.Path)
+	}
+	if want := [][]string{{"big"}, {"sub", "empty"}, {"sub", "small"}}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Files: got %q, want %q", paths, want)
+	}
+	if f := info2.FileTree.Lookup("sub", "small"); f == nil || f.Length != 10 {
+		t.Errorf("Lookup: got %+v", f)
+	}
+	if f := info2.FileTree.Lookup("sub", "missing"); f != nil {
+		t.Errorf("Lookup of missing file: got %+v", f)
+	}
+	if err = mi2.VerifyPieceLayers(info2); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInfoHashV2(t *testing.T) {
+	mi, _ := testV2Torrent(t)
+	h := mi.InfoHashV2()
+	if want := sha256.Sum256(mi.InfoBytes); h != want {
+		t.Errorf("got %s", h)
+	}
+	if tr := h.Truncated(); !bytes.Equal(tr[:], h[:20]) {
+		t.Errorf("Truncated: got %s", tr)
+	}
+}
+
+func TestVerifyPieceLayersCorrupt(t *testing.T) {
+	mi, info := testV2Torrent(t)
+	for root, layer := range mi.PieceLayers {
+		layer[len(layer)-1] ^= 1
+		if err := mi.VerifyPieceLayers(info); err == nil {
+			t.Error("corrupt piece layer verified")
+		}
+		layer[len(layer)-1] ^= 1
+
+		mi.PieceLayers[root] = layer[:len(layer)-sha256.Size]
+		if err := mi.VerifyPieceLayers(info); err == nil {
+			t.Error("short piece layer verified")
+		}
+
+		delete(mi.PieceLayers, root)
+		if err := mi.VerifyPieceLayers(info); err == nil {
+			t.Error("missing piece layer verified")
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package metainfo
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"math/bits"
+	"path/filepath"
+	"strings"
+)
+
+// A Bitfield has one bit for each piece of a torrent, set when the
+// piece is complete. Piece 0 is the high bit of the first byte, as
+// in the bitfield message of the peer wire protocol.
+type Bitfield []byte
+
+// NewBitfield returns a cleared Bitfield for n pieces.
+func NewBitfield(n int) Bitfield { return make(Bitfield, (n+7)/8) }
+
+// Has reports whether the bit of piece i is set.
+func (b Bitfield) Has(i int) bool { return b[i/8]&(0x80>>uint(i%8)) != 0 }
+
+// Set sets the bit of piece i.
+func (b Bitfield) Set(i int) { b[i/8] |= 0x80 >> uint(i%8) }
+
+// Clear clears the bit of piece i.
+func (b Bitfield) Clear(i int) { b[i/8] &^= 0x80 >> uint(i%8) }
+
+// Count returns the number of bits set.
+func (b Bitfield) Count() (n int) {
+	for _, c := range b {
+		n += bits.OnesCount8(c)
+	}
+	return n
+}
+
+// FileStatus describes the state of a file on disk.
+type FileStatus int
+
+const (
+	FileComplete   FileStatus = iota // every piece of the file is complete
+	FileMissing                      // the file could not be opened
+	FileTruncated                    // the file is shorter than expected
+	FileCorrupt                      // a piece of the file failed its hash check
+	FileUnverified                   // a piece shared with a missing or truncated file was not checked
+)
+
+var fileStatusNames = [...]string{"complete", "missing", "truncated", "corrupt", "unverified"}
+
+func (s FileStatus) String() string {
+	if s >= 0 && int(s) < len(fileStatusNames) {
+		return fileStatusNames[s]
+	}
+	return fmt.Sprintf("FileStatus(%d)", int(s))
+}
+
+// FileResult is the result of verifying a single file.
+type FileResult struct {
+	Path   []string
+	Status FileStatus
+	Err    error // cause of a missing or truncated file
+}
+
+// VerifyResult is the result of Verify.
+type VerifyResult struct {
+	// Pieces has the bit of each complete piece set,
+	// and may be stored as resume state.
+	Pieces Bitfield
+
+	// Files holds a result for each file, in the order of
+	// Info.FileList. Padding files are always complete.
+	Files []FileResult
+
+	n int // number of pieces
+}
+
+// Complete reports whether all pieces are complete.
+func (r *VerifyResult) Complete() bool { return r.Pieces.Count() == r.n }
+
+// VerifyOptions holds the optional settings of Verify.
+type VerifyOptions struct {
+	// Workers is the number of goroutines hashing pieces.
+	// If zero, runtime.NumCPU is used.
+	Workers int
+
+	// Progress, if not nil, is called after each piece is
+	// hashed with the number of bytes hashed and the total.
+	// Calls are not concurrent.
+	Progress func(done, total int64)
+}
+
+// Verify hashes the content of info found in dir, the directory
+// the torrent was saved to. A single file torrent is read from
+// dir/Name and the files of a multiple file torrent from
+// dir/Name/Path. Pieces that overlap missing or truncated data
+// are never complete, even if their hash matches, and intact
+// files sharing such a piece are reported as FileUnverified.
+//
+// An error is returned only if info is unusable; problems with
+// the files themselves are reported in the result.
+func Verify(info *Info, dir string, opts *VerifyOptions) (*VerifyResult, error) {
+	if opts == nil {
+		opts = new(VerifyOptions)
+	}
+	if !info.IsV1() {
+		return nil, errors.New("metainfo: no v1 piece hashes to verify")
+	}
+	if info.PieceLength <= 0 {
+		return nil, fmt.Errorf("metainfo: invalid piece length %d", info.PieceLength)
+	}
+	total := info.TotalLength()
+	numPieces := int((total + info.PieceLength - 1) / info.PieceLength)
+	if numPieces != info.NumPieces() || len(info.Pieces)%sha1.Size != 0 {
+		return nil, fmt.Errorf("metainfo: %d piece hashes for %d bytes", len(info.Pieces)/sha1.Size, total)
+	}
+
+	if err := checkPathElem(info.Name); err != nil {
+		return nil, err
+	}
+	base := filepath.Join(dir, info.Name)
+	files := info.FileList()
+	segs := make([]segment, len(files))
+	for i, f := range files {
+		segs[i].length = f.Length
+		switch {
+		case f.IsPadding():
+		case !info.IsDir():
+			segs[i].path = base
+		default:
+			for _, elem := range f.Path {
+				if err := checkPathElem(elem); err != nil {
+					return nil, err
+				}
+			}
+			segs[i].path = filepath.Join(append([]string{base}, f.Path...)...)
+		}
+	}
+
+	res := &VerifyResult{
+		Pieces: NewBitfield(numPieces),
+		Files:  make([]FileResult, len(files)),
+		n:      numPieces,
+	}
+	// valid is the length of the readable prefix of each file.
+	valid := make([]int64, len(files))
+	for i, f := range files {
+		res.Files[i].Path = f.Path
+		valid[i] = f.Length
+	}
+
+	r := &contentReader{
+		segs: segs,
+		fail: func(i int, off int64, err error) {
+			res.Files[i].Err = err
+			if off < 0 {
+				res.Files[i].Status = FileMissing
+				off = 0
+			} else {
+				res.Files[i].Status = FileTruncated
+			}
+			valid[i] = off
+		},
+	}
+	good := make([]bool, numPieces)
+	err := hashPieces(r, total, info.PieceLength, opts.Workers, opts.Progress,
+		func(i int, h [sha1.Size]byte) {
+			good[i] = bytes.Equal(h[:], info.Piece(i))
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	// Pieces overlapping unreadable data were hashed with zeros in
+	// its place, so they are incomplete whatever their hash, and
+	// say nothing of the other files they overlap.
+	unchecked := make([]bool, numPieces)
+	var off int64
+	for i, f := range files {
+		if valid[i] < f.Length {
+			first := (off + valid[i]) / info.PieceLength
+			last := (off + f.Length - 1) / info.PieceLength
+			for p := first; p <= last; p++ {
+				good[p] = false
+				unchecked[p] = true
+			}
+		}
+		off += f.Length
+	}
+	for i, ok := range good {
+		if ok {
+			res.Pieces.Set(i)
+		}
+	}
+
+	off = 0
+	for i, f := range files {
+		if res.Files[i].Status == FileComplete && f.Length > 0 && !f.IsPadding() {
+			first := int(off / info.PieceLength)
+			last := int((off + f.Length - 1) / info.PieceLength)
+			for p := first; p <= last; p++ {
+				if good[p] {
+					continue
+				}
+				if !unchecked[p] {
+					res.Files[i].Status = FileCorrupt
+					break
+				}
+				res.Files[i].Status = FileUnverified
+			}
+		}
+		off += f.Length
+	}
+	return res, nil
+}
+
+// checkPathElem returns an error if elem could
+// name a file outside of its parent directory.
+func checkPathElem(elem string) error {
+	if elem == "" || elem == "." || elem == ".." || strings.ContainsAny(elem, `/\`) {
+		return fmt.Errorf("metainfo: invalid path element %q", elem)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package metainfo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBitfield(t *testing.T) {
+	b := NewBitfield(10)
+	if len(b) != 2 {
+		t.Fatalf("got %d bytes, want 2", len(b))
+	}
+	b.Set(0)
+	b.Set(9)
+	b.Set(3)
+	b.Clear(3)
+	if b[0] != 0x80 || b[1] != 0x40 || b.Count() != 2 || !b.Has(9) || b.Has(3) {
+		t.Errorf("got %08b", b)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	root := writeTestFiles(t)
+	mi, err := Create(root, &CreateOptions{PieceLength: MinPieceLength, Pad: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(root)
+
+	res, err := Verify(info, dir, &VerifyOptions{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Complete() {
+		t.Fatalf("fresh content not complete: %08b %+v", res.Pieces, res.Files)
+	}
+
+	// Corrupt a, truncate b/e and remove f.
+	name := filepath.Join(root, "a")
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[20000] ^= 0xff
+	if err = ioutil.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(filepath.Join(root, "b", "e"), 50000); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(filepath.Join(root, "f")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = Verify(info, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FileStatus{
+		"a":   FileCorrupt,
+		"b/c": FileComplete,
+		"b/d": FileComplete,
+		"b/e": FileTruncated,
+		"f":   FileMissing,
+	}
+	for i, f := range info.Files {
+		if f.IsPadding() {
+			continue
+		}
+		path := filepath.ToSlash(filepath.Join(f.Path...))
+		if got := res.Files[i].Status; got != want[path] {
+			t.Errorf("%s: got %s, want %s (%v)", path, got, want[path], res.Files[i].Err)
+		}
+	}
+
+	// With padding each file starts a piece: a has pieces 0-2, b/c
+	// piece 3, b/e pieces 4-8 of which 4-6 are intact, f piece 9.
+	var got []bool
+	for i := 0; i < info.NumPieces(); i++ {
+		got = append(got, res.Pieces.Has(i))
+	}
+	wantPieces := []bool{true, false, true, true, true, true, true, false, false, false}
+	if len(got) != len(wantPieces) {
+		t.Fatalf("got %d pieces, want %d", len(got), len(wantPieces))
+	}
+	for i := range got {
+		if got[i] != wantPieces[i] {
+			t.Errorf("piece %d: got %v, want %v", i, got[i], wantPieces[i])
+		}
+	}
+	if res.Complete() {
+		t.Error("damaged content is complete")
+	}
+}
+
+func TestVerifyMissingNeighbour(t *testing.T) {
+	// Without padding, a, b/c and b/e share piece 2,
+	// and b/e and f share piece 6.
+	root := writeTestFiles(t)
+	mi, err := Create(root, &CreateOptions{PieceLength: MinPieceLength})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Remove(filepath.Join(root, "b", "c")); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Verify(info, filepath.Dir(root), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]FileStatus{
+		"a":   FileUnverified,
+		"b/c": FileMissing,
+		"b/d": FileComplete,
+		"b/e": FileUnverified,
+		"f":   FileComplete,
+	}
+	for i, f := range info.Files {
+		path := filepath.ToSlash(filepath.Join(f.Path...))
+		if got := res.Files[i].Status; got != want[path] {
+			t.Errorf("%s: got %s, want %s", path, got, want[path])
+		}
+	}
+}
+
+func TestVerifyBadPath(t *testing.T) {
+	info := &Info{
+		Name:        "x",
+		PieceLength: MinPieceLength,
+		Pieces:      make([]byte, 20),
+		Files:       []File{{Length: 1, Path: []string{"..", "etc"}}},
+	}
+	if _, err := Verify(info, t.TempDir(), nil); err == nil {
+		t.Error("path outside of the torrent directory accepted")
+	}
+}
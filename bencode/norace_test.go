@@ -0,0 +1,5 @@
+// +build !race
+
+package bencode
+
+const raceEnabled = false
@@ -0,0 +1,91 @@
+package bencode
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"strconv"
+)
+
+// Bencode integers have no bound. An integer that does not fit
+// in an int64 is decoded into a big.Int, into a Number, or, by a
+// Decoder that was told to, into an interface{}.
+
+var (
+	bigIntType    = reflect.TypeOf(big.Int{})
+	bigIntPtrType = reflect.TypeOf(new(big.Int))
+	numberType    = reflect.TypeOf(Number(""))
+)
+
+// A Number is the decimal form of a bencoded integer,
+// which may be too large for an int64.
+type Number string
+
+// String returns the decimal form of n.
+func (n Number) String() string { return string(n) }
+
+// Int64 returns n as an int64.
+func (n Number) Int64() (int64, error) {
+	return strconv.ParseInt(string(n), 10, 64)
+}
+
+// BigInt returns n as a big.Int.
+func (n Number) BigInt() (*big.Int, error) {
+	z, ok := new(big.Int).SetString(string(n), 10)
+	if !ok {
+		return nil, errors.New("bencode: invalid number " + strconv.Quote(string(n)))
+	}
+	return z, nil
+}
+
+// MarshalBencode encodes n as an integer. The empty Number is 0.
+func (n Number) MarshalBencode() ([]byte, error) {
+	if n == "" {
+		return []byte("i0e"), nil
+	}
+	if !isCanonicalInt(string(n)) {
+		return nil, errors.New("bencode: invalid number " + strconv.Quote(string(n)))
+	}
+	b := make([]byte, 0, len(n)+2)
+	b = append(b, 'i')
+	b = append(b, n...)
+	return append(b, 'e'), nil
+}
+
+// UnmarshalBencode sets *n to the decimal form of the integer data.
+func (n *Number) UnmarshalBencode(data []byte) error {
+	v, err := single(data)
+	if err != nil {
+		return err
+	}
+	s := string(v[1 : len(v)-1])
+	if v[0] != 'i' || !isCanonicalInt(s) {
+		return NewUnmarshalTypeError(v, numberType)
+	}
+	*n = Number(s)
+	return nil
+}
+
+// isCanonicalInt reports whether s is an integer as BEP 3 writes
+// them: an optional minus sign and digits, with no leading zero,
+// and no minus sign before zero.
+func isCanonicalInt(s string) bool {
+	if s != "" && s[0] == '-' {
+		s = s[1:]
+		if s == "0" {
+			return false
+		}
+	}
+	if s == "" || (s[0] == '0' && len(s) > 1) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+var _ Marshaler = Number("")
+var _ Unmarshaler = (*Number)(nil)
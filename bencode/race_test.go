@@ -0,0 +1,7 @@
+// +build race
+
+package bencode
+
+// raceEnabled reports whether the race detector is on, under
+// which sync.Pool drops items at random.
+const raceEnabled = true
@@ -0,0 +1,234 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The functions in this file work on bencoded values directly.
+// They are used by the methods that bencodegen generates, and
+// are useful to hand-written Marshalers and Unmarshalers.
+
+// AppendInt appends the bencoding of i to b.
+func AppendInt(b []byte, i int64) []byte {
+	b = append(b, 'i')
+	b = strconv.AppendInt(b, i, 10)
+	return append(b, 'e')
+}
+
+// AppendUint appends the bencoding of u to b.
+func AppendUint(b []byte, u uint64) []byte {
+	b = append(b, 'i')
+	b = strconv.AppendUint(b, u, 10)
+	return append(b, 'e')
+}
+
+// AppendString appends the bencoding of s to b.
+func AppendString(b []byte, s string) []byte {
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, ':')
+	return append(b, s...)
+}
+
+// AppendBytes appends the bencoding of s to b.
+func AppendBytes(b, s []byte) []byte {
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, ':')
+	return append(b, s...)
+}
+
+// AppendMarshal appends the bencoding of v to b, as by Marshal.
+func AppendMarshal(b []byte, v interface{}) ([]byte, error) {
+	e := &encodeState{}
+	if err := e.marshal(v); err != nil {
+		return nil, err
+	}
+	return append(b, e.Bytes()...), nil
+}
+
+// single returns data if it holds exactly one value.
+func single(data []byte) ([]byte, error) {
+	var scan scanner
+	v, rest, err := nextValue(data, &scan)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, &SyntaxError{"invalid character " + strconv.Quote(string(rune(rest[0]))) + " after top-level value", int64(len(v))}
+	}
+	return v, nil
+}
+
+// ParseInt returns the value of the bencoded integer data.
+func ParseInt(data []byte) (int64, error) {
+	v, err := single(data)
+	if err != nil {
+		return 0, err
+	}
+	if v[0] != 'i' {
+		return 0, errors.New("bencode: value is not an integer")
+	}
+	return strconv.ParseInt(string(v[1:len(v)-1]), 10, 64)
+}
+
+// ParseUint is like ParseInt but for an unsigned integer.
+func ParseUint(data []byte) (uint64, error) {
+	v, err := single(data)
+	if err != nil {
+		return 0, err
+	}
+	if v[0] != 'i' {
+		return 0, errors.New("bencode: value is not an integer")
+	}
+	return strconv.ParseUint(string(v[1:len(v)-1]), 10, 64)
+}
+
+// ParseString returns the contents of the bencoded string data.
+// The result refers to data.
+func ParseString(data []byte) ([]byte, error) {
+	v, err := single(data)
+	if err != nil {
+		return nil, err
+	}
+	if v[0] < '0' || v[0] > '9' {
+		return nil, errors.New("bencode: value is not a string")
+	}
+	return v[bytes.IndexByte(v, ':')+1:], nil
+}
+
+// ForEachElement calls f with the encoding of each element
+// of the bencoded list data, stopping at the first error.
+// The slices passed to f refer to data. An error from f is
+// returned with the index and offset of the element, as by
+// Unmarshal.
+func ForEachElement(data []byte, f func(elem []byte) error) error {
+	if len(data) == 0 || data[0] != 'l' {
+		return errors.New("bencode: value is not a list")
+	}
+	var scan scanner
+	off := 1
+	for i := 0; ; i++ {
+		end, err := endOfContainer(data, off)
+		if end || err != nil {
+			return err
+		}
+		elem, rest, err := nextValueAt(data, off, &scan)
+		if err != nil {
+			return err
+		}
+		if err = f(elem); err != nil {
+			return atPath(err, "["+strconv.Itoa(i)+"]", int64(off))
+		}
+		off = len(data) - len(rest)
+	}
+}
+
+// ForEachEntry calls f with the key and the encoding of the value
+// of each entry of the bencoded dictionary data, stopping at the
+// first error. The slices passed to f refer to data. An error from
+// f is returned with the key and offset of the value, as by Unmarshal.
+func ForEachEntry(data []byte, f func(key, value []byte) error) error {
+	if len(data) == 0 || data[0] != 'd' {
+		return errors.New("bencode: value is not a dictionary")
+	}
+	var scan scanner
+	off := 1
+	for {
+		end, err := endOfContainer(data, off)
+		if end || err != nil {
+			return err
+		}
+		if c := data[off]; c < '0' || c > '9' {
+			return &SyntaxError{"invalid character " + strconv.Quote(string(rune(c))) + " in start of dictionary key length", int64(off)}
+		}
+		key, rest, err := nextValueAt(data, off, &scan)
+		if err != nil {
+			return err
+		}
+		key = key[bytes.IndexByte(key, ':')+1:]
+		off = len(data) - len(rest)
+		if off == len(data) {
+			return &SyntaxError{"unexpected end of bencode input", int64(off)}
+		}
+		value, rest, err := nextValueAt(data, off, &scan)
+		if err != nil {
+			return err
+		}
+		if err = f(key, value); err != nil {
+			return atPath(err, string(key), int64(off))
+		}
+		off = len(data) - len(rest)
+	}
+}
+
+// endOfContainer reports whether the list or dictionary
+// data ends at off, where it must end if not before.
+func endOfContainer(data []byte, off int) (bool, error) {
+	switch {
+	case off == len(data):
+		return false, &SyntaxError{"unexpected end of bencode input", int64(off)}
+	case data[off] != 'e':
+		return false, nil
+	case off+1 < len(data):
+		return false, &SyntaxError{"invalid character " + strconv.Quote(string(rune(data[off+1]))) + " after top-level value", int64(off + 1)}
+	}
+	return true, nil
+}
+
+// MatchKey returns the index of the name in names that Unmarshal
+// would store the value of a dictionary key in, or -1 if there is
+// none. names are the keys of the fields of a struct, in sorted order.
+// An exact match is preferred to a case-insensitive one.
+func MatchKey(key []byte, names []string) int {
+	fold := -1
+	for i, name := range names {
+		if name == string(key) {
+			return i
+		}
+		if fold < 0 && strings.EqualFold(name, string(key)) {
+			fold = i
+		}
+	}
+	return fold
+}
+
+// RestKeys returns the keys of m, the field of a struct with the
+// "rest" option, that are not in names, the sorted keys of the other
+// fields of the struct. They are sorted, for merging with the other
+// fields as Marshal does.
+func RestKeys(m map[string]RawMessage, names []string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		if i := sort.SearchStrings(names, k); i < len(names) && names[i] == k {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// NewUnmarshalTypeError returns the error that Unmarshal returns
+// when the bencoded value data cannot be stored in a value of type t.
+func NewUnmarshalTypeError(data []byte, t reflect.Type) error {
+	v, err := single(data)
+	if err != nil {
+		return err
+	}
+	var desc string
+	switch v[0] {
+	case 'i':
+		desc = "integer " + string(v[1:len(v)-1])
+	case 'l':
+		desc = "list"
+	case 'd':
+		desc = "dictionary"
+	default:
+		desc = "string"
+	}
+	return &UnmarshalTypeError{Value: desc, Type: t}
+}
@@ -1,6 +1,9 @@
 package bencode
 
-import "strconv"
+import (
+	"bytes"
+	"strconv"
+)
 
 // checkValid verifies that data is valid bencode encoded data.
 // scan is passed in for use by checkValid to avoid an allocation.
@@ -24,30 +27,115 @@ func checkValid(data []byte, scan *scanner) error {
 	return nil
 }
 
+// Valid checks that data is a single valid bencode value.
+// It returns a *SyntaxError describing the first problem found, if any.
+func Valid(data []byte) error {
+	var scan scanner
+	return checkValue(data, &scan, false)
+}
+
+// ValidCanonical is like Valid but also requires that data is in
+// the canonical form described by BEP 3: dictionary keys must be
+// sorted and unique, and integers and string lengths may not have
+// leading zeros or be negative zero.
+func ValidCanonical(data []byte) error {
+	var scan scanner
+	return checkValue(data, &scan, true)
+}
+
+// checkValue verifies that data is a single bencode value,
+// and if strict is set, that it is in canonical form.
+// scan is passed in for use by checkValue to avoid an allocation.
+func checkValue(data []byte, scan *scanner, strict bool) error {
+	scan.reset()
+	scan.strict = strict
+
+	// keys holds the last key read at each level of parseState.
+	var keys [][]byte
+	var inKey bool
+	var op int
+	for i := 0; i < len(data); i++ {
+		scan.bytes = int64(i)
+		op = scan.step(scan, int(data[i]))
+		switch {
+		case op == scanError:
+			return scan.err
+		case op == scanBeginKeyLen:
+			inKey = true
+		}
+
+		n := len(scan.parseState)
+		if n < len(keys) {
+			keys = keys[:n]
+		}
+		for len(keys) < n {
+			keys = append(keys, nil)
+		}
+
+		if op >= 0 && !(op == scanBeginInteger && data[i] == 'i') {
+			if i+op >= len(data) {
+				return &SyntaxError{"unexpected end of bencode input", int64(len(data))}
+			}
+			if inKey {
+				key := data[i+1 : i+1+op]
+				if prev := keys[n-1]; strict && prev != nil {
+					switch c := bytes.Compare(prev, key); {
+					case c == 0:
+						return &SyntaxError{"duplicate dictionary key " + strconv.Quote(string(key)), int64(i + 1)}
+					case c > 0:
+						return &SyntaxError{"unsorted dictionary key " + strconv.Quote(string(key)), int64(i + 1)}
+					}
+				}
+				keys[n-1] = key
+				inKey = false
+			}
+			i += op
+		}
+
+		if scan.endTop && i+1 < len(data) {
+			return &SyntaxError{"invalid character " + strconv.Quote(string(rune(data[i+1]))) + " after top-level value", int64(i + 1)}
+		}
+	}
+	if !scan.endTop {
+		return &SyntaxError{"unexpected end of bencode input", int64(len(data))}
+	}
+	return nil
+}
+
+// SplitValue splits data after the first whole bencode value,
+// returning that value and the bytes that follow it. It is useful
+// for messages that carry a binary payload after a bencoded
+// dictionary. It returns a *SyntaxError if data does not begin
+// with a valid value. The value is not decoded; UnmarshalPrefix
+// splits data with SplitValue and decodes the value.
+func SplitValue(data []byte) (value, rest []byte, err error) {
+	var scan scanner
+	return nextValue(data, &scan)
+}
+
 // nextValue splits data after the next whole bencode value,
-// returning thet value and the bytes that follow it as seperate slices.
+// returning that value and the bytes that follow it as separate slices.
 // scan is passed in for use by nextValue to avoid an allocation.
 func nextValue(data []byte, scan *scanner) (value, rest []byte, err error) {
 	scan.reset()
-	var c, op int
+	var op int
 	for i := 0; i < len(data); i++ {
-		c = int(data[i])
-		op = scan.step(scan, c)
+		scan.bytes = int64(i)
+		op = scan.step(scan, int(data[i]))
+		if op == scanError {
+			return nil, nil, scan.err
+		}
 		if op > 0 {
-			i += op
-		} else if op <= scanEnd {
-			switch op {
-			case scanError:
-				return nil, nil, scan.err
-			case scanEnd:
-				return data[0:i], data[i:], nil
+			if i+op >= len(data) {
+				break
 			}
+			i += op
+		}
+		if scan.endTop {
+			return data[:i+1], data[i+1:], nil
 		}
 	}
-	if scan.eof() == scanError {
-		return nil, nil, scan.err
-	}
-	return data, nil, nil
+	return nil, nil, &SyntaxError{"unexpected end of bencode input", int64(len(data))}
 }
 
 // A SyntaxError is a description of a becode syntax error.
@@ -58,6 +146,20 @@ type SyntaxError struct {
 
 func (e *SyntaxError) Error() string { return e.msg }
 
+// A LimitError is returned when a value exceeds a limit
+// set by DecoderOptions.
+type LimitError struct {
+	Limit  string // name of the DecoderOptions field
+	Offset int64  // offset of the byte that exceeded the limit
+}
+
+func (e *LimitError) Error() string {
+	return "bencode: " + e.Limit + " exceeded at offset " + strconv.FormatInt(e.Offset, 10)
+}
+
+// maxInt is the largest value of an int.
+const maxInt = int(^uint(0) >> 1)
+
 // These values are returned by the state transition functions
 // assigned to scanner.state and the method scanner.eof.
 // They give details about the current state of the scan that
@@ -121,7 +223,7 @@ func stateError(s *scanner, c int) int {
 // error records an error and switches to the error state.
 func (s *scanner) error(c int, context string) int {
 	s.step = stateError
-	s.err = &SyntaxError{"invalid character " + strconv.Quote(string(c)) + " " + context, s.bytes}
+	s.err = &SyntaxError{"invalid character " + strconv.Quote(string(rune(c))) + " " + context, s.bytes}
 	return scanError
 }
 
@@ -147,6 +249,13 @@ func (s *scanner) eof() int {
 // pushParseState pushes a new parse state p onto the parse stack.
 func (s *scanner) pushParseState(p int) {
 	s.parseState = append(s.parseState, p)
+	if s.limits != nil {
+		n := len(s.parseState)
+		for len(s.counts) < n {
+			s.counts = append(s.counts, 0)
+		}
+		s.counts[n-1] = 0
+	}
 }
 
 // popParseState pops a parse state (alread obtained) off the stack
@@ -161,21 +270,137 @@ func (s *scanner) popParseState() {
 }
 
 
-// stateParseInteger is the state after reading an `i`.
+// limitError records that limit was exceeded and
+// switches to the error state.
+func (s *scanner) limitError(limit string) int {
+	s.step = stateError
+	s.err = &LimitError{limit, s.bytes}
+	return scanError
+}
+
+// checkBegin checks the limits of s before
+// beginning a value with the byte c.
+func (s *scanner) checkBegin(c int) int {
+	n := len(s.parseState)
+	if n > 0 && s.parseState[n-1] == parseListValue && s.countElement() == scanError {
+		return scanError
+	}
+	if (c == 'l' || c == 'd') && s.limits.MaxDepth > 0 && n >= s.limits.MaxDepth {
+		return s.limitError("MaxDepth")
+	}
+	return 0
+}
+
+// countElement counts an element of the innermost list
+// or an entry of the innermost dictionary.
+func (s *scanner) countElement() int {
+	n := len(s.parseState)
+	s.counts[n-1]++
+	if max := s.limits.MaxElements; max > 0 && s.counts[n-1] > max {
+		return s.limitError("MaxElements")
+	}
+	return 0
+}
+
+// checkStringLen checks the length of a string or key,
+// or the part of it read so far.
+func (s *scanner) checkStringLen(n int) int {
+	if s.limits != nil && s.limits.MaxStringLength > 0 && n > s.limits.MaxStringLength {
+		return s.limitError("MaxStringLength")
+	}
+	return 0
+}
+
+// stateParseInteger is the state after reading an `i`. Outside
+// strict mode, leading zeros and negative zero are accepted, but
+// an integer must still be an optional minus sign and digits.
 func stateParseInteger(s *scanner, c int) int {
+	switch {
+	case c == '-':
+		s.step = stateParseNegInteger
+		return scanParseInteger
+	case c >= '0' && c <= '9':
+		s.step = stateParseLaxDigits
+		return scanParseInteger
+	}
+	return s.error(c, "in integer")
+}
+
+// stateParseNegInteger is the state after reading `i-`.
+func stateParseNegInteger(s *scanner, c int) int {
+	if c >= '0' && c <= '9' {
+		s.step = stateParseLaxDigits
+		return scanParseInteger
+	}
+	return s.error(c, "after minus sign in integer")
+}
+
+// stateParseLaxDigits is the state after reading
+// a digit of an integer outside strict mode.
+func stateParseLaxDigits(s *scanner, c int) int {
 	if c == 'e' {
-		s.popParseState()
-		if s.endTop {
-			return scanEnd
-		}
-		return scanEndInteger
+		return s.endInteger()
+	}
+	if c >= '0' && c <= '9' {
+		return scanParseInteger
 	}
-	if (c >= '0' && c <= '9') || c == '-' {
+	return s.error(c, "in integer")
+}
+
+// stateBeginInteger is the state after reading an `i` in strict mode.
+func stateBeginInteger(s *scanner, c int) int {
+	switch {
+	case c == '-':
+		s.step = stateBeginNegInteger
+		return scanParseInteger
+	case c == '0':
+		s.step = stateEndZeroInteger
+		return scanParseInteger
+	case c >= '1' && c <= '9':
+		s.step = stateParseIntegerDigits
 		return scanParseInteger
 	}
 	return s.error(c, "in integer")
 }
 
+// stateBeginNegInteger is the state after reading `i-` in strict mode.
+func stateBeginNegInteger(s *scanner, c int) int {
+	if c >= '1' && c <= '9' {
+		s.step = stateParseIntegerDigits
+		return scanParseInteger
+	}
+	return s.error(c, "after minus sign in integer")
+}
+
+// stateEndZeroInteger is the state after reading `i0` in strict mode.
+func stateEndZeroInteger(s *scanner, c int) int {
+	if c == 'e' {
+		return s.endInteger()
+	}
+	return s.error(c, "after leading zero in integer")
+}
+
+// stateParseIntegerDigits is the state after reading
+// a non-zero digit of an integer in strict mode.
+func stateParseIntegerDigits(s *scanner, c int) int {
+	if c == 'e' {
+		return s.endInteger()
+	}
+	if c >= '0' && c <= '9' {
+		return scanParseInteger
+	}
+	return s.error(c, "in integer")
+}
+
+// endInteger pops the integer parse state after reading its `e`.
+func (s *scanner) endInteger() int {
+	s.popParseState()
+	if s.endTop {
+		return scanEnd
+	}
+	return scanEndInteger
+}
+
 func stateBeginListValue(s *scanner, c int) int {
 	if c == 'e' {
 		s.popParseState()
@@ -0,0 +1,363 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// A Token holds a value of one of these types:
+//
+// Int, for bencode integers
+// Number, for bencode integers that do not fit in an Int
+// String, for bencode strings and dictionary keys
+// Delim, for the start and end of lists and dictionaries
+type Token interface{}
+
+// An Int is a bencode integer token.
+type Int int64
+
+// A String is a bencode string token.
+type String []byte
+
+// A Delim is a bencode list or dictionary delimiter token,
+// one of ListStart, DictStart or End.
+type Delim byte
+
+const (
+	ListStart Delim = 'l'
+	DictStart Delim = 'd'
+	End       Delim = 'e'
+)
+
+func (d Delim) String() string {
+	switch d {
+	case ListStart:
+		return "ListStart"
+	case DictStart:
+		return "DictStart"
+	case End:
+		return "End"
+	}
+	return "Delim(" + strconv.Itoa(int(d)) + ")"
+}
+
+// Token returns the next bencode token in the input stream.
+// At the end of the input stream, Token returns nil, io.EOF.
+//
+// Lists and dictionaries are not read into memory, only the
+// integer or string at the current position is. Dictionary
+// keys are returned as String tokens, each followed by the
+// tokens of its value. Token guarantees that the delimiters it
+// returns are properly nested and matched: if Token encounters
+// an unexpected delimiter in the input, it will return an error.
+func (dec *Decoder) Token() (Token, error) {
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if len(dec.tokenScan.parseState) == 0 {
+		dec.tokenScan.reset()
+	}
+
+	var tok Token
+	c, err := dec.peek(0)
+	if err != nil {
+		return nil, dec.tokenError(err)
+	}
+	top := -1
+	if n := len(dec.tokenScan.parseState); n > 0 {
+		top = dec.tokenScan.parseState[n-1]
+	}
+	op := dec.tokenStep(c, 0)
+	scanp := 1
+
+	switch {
+	case c == 'i' && op == scanBeginInteger:
+		for op != scanEndInteger && op != scanEnd {
+			if c, err = dec.peek(scanp); err != nil {
+				return nil, dec.tokenError(err)
+			}
+			op = dec.tokenStep(c, scanp)
+			scanp++
+			if op == scanError {
+				dec.err = dec.tokenScan.err
+				return nil, dec.err
+			}
+		}
+		// The scanner has checked the digits,
+		// so only the range of the integer may fail.
+		digits := string(dec.buf[1 : scanp-1])
+		if n, err := strconv.ParseInt(digits, 10, 64); err == nil {
+			tok = Int(n)
+		} else {
+			tok = Number(digits)
+		}
+		dec.consume(scanp)
+		dec.tokenValueEnd()
+
+	case op == scanBeginStringLen, op == scanBeginKeyLen:
+		key := op == scanBeginKeyLen
+		for op < 0 {
+			if c, err = dec.peek(scanp); err != nil {
+				return nil, dec.tokenError(err)
+			}
+			op = dec.tokenStep(c, scanp)
+			scanp++
+			if op == scanError {
+				dec.err = dec.tokenScan.err
+				return nil, dec.err
+			}
+		}
+		// op is now the length of the string.
+		if op > 0 {
+			if _, err = dec.peek(scanp + op - 1); err != nil {
+				return nil, dec.tokenError(err)
+			}
+		}
+		b := make(String, op)
+		copy(b, dec.buf[scanp:])
+		if key && dec.tokenScan.strict {
+			if err = dec.tokenCheckKey(b, scanp); err != nil {
+				dec.err = err
+				return nil, err
+			}
+		}
+		tok = b
+		dec.consume(scanp + op)
+		if key {
+			dec.tokenKey = false
+		} else {
+			dec.tokenValueEnd()
+		}
+
+	case op == scanBeginList:
+		tok = ListStart
+		dec.consume(scanp)
+		dec.tokenKey = false
+
+	case op == scanBeginDict:
+		tok = DictStart
+		dec.consume(scanp)
+		dec.tokenKey = true
+		if dec.tokenScan.strict {
+			dec.tokenKeys = append(dec.tokenKeys, nil)
+		}
+
+	case op == scanEndList, op == scanEndDict, op == scanEnd:
+		tok = End
+		dec.consume(scanp)
+		dec.tokenValueEnd()
+		if top == parseDictValue && len(dec.tokenKeys) > 0 {
+			dec.tokenKeys = dec.tokenKeys[:len(dec.tokenKeys)-1]
+		}
+
+	case op == scanError:
+		dec.err = dec.tokenScan.err
+		return nil, dec.err
+
+	default:
+		dec.err = errPhase
+		return nil, dec.err
+	}
+	return tok, nil
+}
+
+// More reports whether there is another element in the
+// current list or dictionary being parsed, or at the top
+// level, whether there is another value in the input stream.
+func (dec *Decoder) More() bool {
+	c, err := dec.peek(0)
+	return err == nil && c != 'e'
+}
+
+// InputOffset returns the input stream byte offset of the current
+// decoder position. The offset gives the location of the end of the
+// most recently returned token and the beginning of the next token.
+func (dec *Decoder) InputOffset() int64 {
+	return dec.scanned
+}
+
+// tokenStep feeds the byte at offset scanp of dec.buf to the token scanner.
+func (dec *Decoder) tokenStep(c byte, scanp int) int {
+	dec.tokenScan.bytes = dec.scanned + int64(scanp)
+	return dec.tokenScan.step(&dec.tokenScan, int(c))
+}
+
+// tokenValueEnd updates the token state after a complete value.
+func (dec *Decoder) tokenValueEnd() {
+	n := len(dec.tokenScan.parseState)
+	dec.tokenKey = n > 0 && dec.tokenScan.parseState[n-1] == parseDictValue
+}
+
+// tokenCheckKey checks that key, found at offset scanp of dec.buf,
+// sorts after the previous key of the innermost dictionary.
+func (dec *Decoder) tokenCheckKey(key String, scanp int) error {
+	n := len(dec.tokenKeys)
+	if n == 0 {
+		return nil
+	}
+	if prev := dec.tokenKeys[n-1]; prev != nil {
+		switch c := bytes.Compare(prev, key); {
+		case c == 0:
+			return &SyntaxError{"duplicate dictionary key " + strconv.Quote(string(key)), dec.scanned + int64(scanp)}
+		case c > 0:
+			return &SyntaxError{"unsorted dictionary key " + strconv.Quote(string(key)), dec.scanned + int64(scanp)}
+		}
+	}
+	dec.tokenKeys[n-1] = key
+	return nil
+}
+
+// tokenError records a read error encountered by Token.
+// A clean end of input between top-level values is not recorded.
+func (dec *Decoder) tokenError(err error) error {
+	if err == io.EOF {
+		if len(dec.tokenScan.parseState) == 0 && len(dec.buf) == 0 {
+			return io.EOF
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	dec.err = err
+	return err
+}
+
+// The methods below write a value piecewise, straight to the
+// Encoder's writer, so that a large list or dictionary need not
+// be held in memory. Encode may be called between them to write
+// the next list element or dictionary value.
+
+// An encLevel is the state of a list or dictionary
+// opened by BeginList or BeginDict.
+type encLevel struct {
+	dict      bool
+	wantValue bool   // a key has been written, but not its value
+	hasKey    bool   // key holds the last key written
+	key       string // last key written
+}
+
+// WriteInt writes the integer i.
+func (enc *Encoder) WriteInt(i int64) error {
+	if err := enc.beginValue(); err != nil {
+		return err
+	}
+	return enc.write(AppendInt(enc.e.scratch[:0], i))
+}
+
+// WriteBytes writes the string b.
+func (enc *Encoder) WriteBytes(b []byte) error {
+	if err := enc.beginValue(); err != nil {
+		return err
+	}
+	if err := enc.write(strconv.AppendInt(enc.e.scratch[:0], int64(len(b)), 10)); err != nil {
+		return err
+	}
+	if err := enc.write([]byte{':'}); err != nil {
+		return err
+	}
+	return enc.write(b)
+}
+
+// WriteString writes the string s.
+func (enc *Encoder) WriteString(s string) error {
+	return enc.WriteBytes([]byte(s))
+}
+
+// BeginList starts a list, which End finishes.
+func (enc *Encoder) BeginList() error {
+	return enc.begin(ListStart)
+}
+
+// BeginDict starts a dictionary, which End finishes. Each of its
+// entries is written by WriteKey followed by a value, and the keys
+// must be written in sorted order.
+func (enc *Encoder) BeginDict() error {
+	return enc.begin(DictStart)
+}
+
+func (enc *Encoder) begin(d Delim) error {
+	if err := enc.beginValue(); err != nil {
+		return err
+	}
+	if err := enc.write([]byte{byte(d)}); err != nil {
+		return err
+	}
+	enc.levels = append(enc.levels, encLevel{dict: d == DictStart})
+	return nil
+}
+
+// WriteKey writes the key of the next entry of the dictionary
+// started by BeginDict. key must sort after the previous key.
+func (enc *Encoder) WriteKey(key string) error {
+	if enc.err != nil {
+		return enc.err
+	}
+	n := len(enc.levels)
+	if n == 0 || !enc.levels[n-1].dict {
+		return errors.New("bencode: WriteKey called outside a dictionary")
+	}
+	l := &enc.levels[n-1]
+	if l.wantValue {
+		return errors.New("bencode: WriteKey called while expecting a dictionary value")
+	}
+	if l.hasKey && key <= l.key {
+		if key == l.key {
+			return errors.New("bencode: duplicate dictionary key " + strconv.Quote(key))
+		}
+		return errors.New("bencode: unsorted dictionary key " + strconv.Quote(key))
+	}
+	if err := enc.write(AppendString(enc.e.scratch[:0], key)); err != nil {
+		return err
+	}
+	l.wantValue, l.hasKey, l.key = true, true, key
+	return nil
+}
+
+// End finishes the innermost list or dictionary.
+func (enc *Encoder) End() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	n := len(enc.levels)
+	if n == 0 {
+		return errors.New("bencode: End called outside a list or dictionary")
+	}
+	if enc.levels[n-1].wantValue {
+		return errors.New("bencode: End called while expecting a dictionary value")
+	}
+	if err := enc.write([]byte{byte(End)}); err != nil {
+		return err
+	}
+	enc.levels = enc.levels[:n-1]
+	return nil
+}
+
+// beginValue checks that a value may be written next,
+// and if it is a dictionary value, marks it as written.
+func (enc *Encoder) beginValue() error {
+	if enc.err != nil {
+		return enc.err
+	}
+	n := len(enc.levels)
+	if n == 0 || !enc.levels[n-1].dict {
+		return nil
+	}
+	l := &enc.levels[n-1]
+	if !l.wantValue {
+		return errors.New("bencode: value written while expecting a dictionary key")
+	}
+	l.wantValue = false
+	return nil
+}
+
+// write writes b to the Encoder's writer,
+// recording the first error.
+func (enc *Encoder) write(b []byte) error {
+	if enc.err != nil {
+		return enc.err
+	}
+	if _, err := enc.w.Write(b); err != nil {
+		enc.err = err
+	}
+	return enc.err
+}
@@ -1,6 +1,7 @@
 package bencode
 
 import (
+	"errors"
 	"reflect"
 	"sort"
 	"strings"
@@ -11,10 +12,14 @@ import (
 // A field represents a single field found in a struct.
 type field struct {
 	name      string
+	goName    string // name of the Go struct field
 	tag       bool
 	index     []int
 	typ       reflect.Type
 	omitEmpty bool
+	rest      bool // collects unknown keys; see splitRest
+	quoted    bool // number encoded as a decimal string
+	unixMilli bool // time encoded in milliseconds
 }
 
 // byName sorts field by name, breaking ties with depth,
@@ -71,14 +76,81 @@ func fieldByIndex(v reflect.Value, index []int) reflect.Value {
 	return v
 }
 
-// stringValues is a slice of reflect.Value holding *reflect.StringValue.
-// It implements the methods to sort by string.
-type stringValues []reflect.Value
+// fieldByIndexAlloc is like fieldByIndex, but allocates the
+// nil embedded struct pointers on the way to the field. It fails
+// if such a pointer is to an unexported type, and cannot be set.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for _, i := range index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, errors.New("bencode: cannot set embedded pointer to unexported struct: " + v.Type().Elem().String())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, nil
+}
+
+var restType = reflect.TypeOf(map[string]RawMessage(nil))
+
+// isNumberKind reports whether the "string" option applies to k.
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
 
-func (sv stringValues) Len() int           { return len(sv) }
-func (sv stringValues) Swap(i, j int)      { sv[i], sv[j] = sv[j], sv[i] }
-func (sv stringValues) Less(i, j int) bool { return sv.get(i) < sv.get(j) }
-func (sv stringValues) get(i int) string   { return sv[i].String() }
+// splitRest returns the fields of a struct without the field
+// with the "rest" option, which typeFields puts last, and that
+// field, or nil if there is none.
+func splitRest(fields []field) ([]field, *field) {
+	if n := len(fields); n > 0 && fields[n-1].rest {
+		return fields[:n-1], &fields[n-1]
+	}
+	return fields, nil
+}
+
+// A mapKey is a map key and its encoding as a dictionary key.
+type mapKey struct {
+	s string
+	v reflect.Value
+}
+
+// byKey sorts map keys by their encoding.
+type byKey []mapKey
+
+func (x byKey) Len() int           { return len(x) }
+func (x byKey) Swap(i, j int)      { x[i], x[j] = x[j], x[i] }
+func (x byKey) Less(i, j int) bool { return x[i].s < x[j].s }
+
+// isMapKeyType reports whether maps with keys of type t
+// can be encoded, or if unmarshal is set, decoded. Keys are
+// strings, integers, byte arrays, or types implementing
+// encoding.TextMarshaler or encoding.TextUnmarshaler.
+func isMapKeyType(t reflect.Type, unmarshal bool) bool {
+	switch t.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	case reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return true
+		}
+	}
+	if unmarshal {
+		return reflect.PtrTo(t).Implements(textUnmarshalerType)
+	}
+	return t.Implements(textMarshalerType)
+}
 
 // byIndex sorts field by index sequence.
 type byIndex []field
@@ -117,6 +189,9 @@ func typeFields(t reflect.Type) []field {
 	// Fields found.
 	var fields []field
 
+	// The least nested field with the "rest" option.
+	var rest *field
+
 	for len(next) > 0 {
 		current, next = next, current[:0]
 		count, nextCount = nextCount, map[reflect.Type]int{}
@@ -130,7 +205,17 @@ func typeFields(t reflect.Type) []field {
 			// Scan f.typ for fields to include.
 			for i := 0; i < f.typ.NumField(); i++ {
 				sf := f.typ.Field(i)
-				if sf.PkgPath != "" { // unexported
+				if sf.Anonymous {
+					t := sf.Type
+					if t.Kind() == reflect.Ptr {
+						t = t.Elem()
+					}
+					// The exported fields of an embedded struct
+					// of an unexported type are promoted as well.
+					if sf.PkgPath != "" && t.Kind() != reflect.Struct {
+						continue
+					}
+				} else if sf.PkgPath != "" { // unexported
 					continue
 				}
 				tag := sf.Tag.Get("bencode")
@@ -145,6 +230,14 @@ func typeFields(t reflect.Type) []field {
 				copy(index, f.index)
 				index[len(f.index)] = i
 
+				if opts.Contains("rest") && sf.Type == restType {
+					// Breadth-first search finds the least nested first.
+					if rest == nil {
+						rest = &field{name: sf.Name, index: index, typ: sf.Type, rest: true}
+					}
+					continue
+				}
+
 				ft := sf.Type
 				if ft.Name() == "" && ft.Kind() == reflect.Ptr {
 					// Follow pointer.
@@ -157,8 +250,16 @@ func typeFields(t reflect.Type) []field {
 					if name == "" {
 						name = sf.Name
 					}
-					fields = append(fields, field{name, tagged, index, ft,
-						opts.Contains("omitempty")})
+					fields = append(fields, field{
+						name:      name,
+						goName:    sf.Name,
+						tag:       tagged,
+						index:     index,
+						typ:       ft,
+						omitEmpty: opts.Contains("omitempty"),
+						quoted:    opts.Contains("string") && isNumberKind(ft.Kind()),
+						unixMilli: opts.Contains("unixms") && ft == timeType,
+					})
 					if count[f.typ] > 1 {
 						// If there were multiple instances, add a second,
 						// so that the annihilation code will see a duplicate.
@@ -208,6 +309,9 @@ func typeFields(t reflect.Type) []field {
 		}
 	}
 
+	if rest != nil {
+		out = append(out, *rest)
+	}
 	return out
 }
 
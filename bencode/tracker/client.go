@@ -0,0 +1,218 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// Announce events.
+const (
+	EventNone      = ""
+	EventStarted   = "started"
+	EventStopped   = "stopped"
+	EventCompleted = "completed"
+)
+
+// An AnnounceRequest holds the parameters of an announce.
+type AnnounceRequest struct {
+	InfoHash [20]byte
+	PeerID   [20]byte
+	Port     int
+
+	Uploaded   int64
+	Downloaded int64
+	Left       int64
+
+	Event string
+
+	// IP, if not empty, is the address the tracker
+	// should give to other peers.
+	IP string
+
+	// NumWant is the number of peers wanted. If zero,
+	// the tracker chooses.
+	NumWant int
+
+	Key       string
+	TrackerID string
+
+	// NoCompact asks for peers in dictionary form.
+	NoCompact bool
+}
+
+// Query returns the URL query string of r.
+func (r *AnnounceRequest) Query() string {
+	q := []string{
+		"info_hash=" + escape(r.InfoHash[:]),
+		"peer_id=" + escape(r.PeerID[:]),
+		"port=" + strconv.Itoa(r.Port),
+		"uploaded=" + strconv.FormatInt(r.Uploaded, 10),
+		"downloaded=" + strconv.FormatInt(r.Downloaded, 10),
+		"left=" + strconv.FormatInt(r.Left, 10),
+	}
+	if r.NoCompact {
+		q = append(q, "compact=0")
+	} else {
+		q = append(q, "compact=1")
+	}
+	if r.Event != EventNone {
+		q = append(q, "event="+escape([]byte(r.Event)))
+	}
+	if r.IP != "" {
+		q = append(q, "ip="+escape([]byte(r.IP)))
+	}
+	if r.NumWant > 0 {
+		q = append(q, "numwant="+strconv.Itoa(r.NumWant))
+	}
+	if r.Key != "" {
+		q = append(q, "key="+escape([]byte(r.Key)))
+	}
+	if r.TrackerID != "" {
+		q = append(q, "trackerid="+escape([]byte(r.TrackerID)))
+	}
+	return strings.Join(q, "&")
+}
+
+// escape percent-encodes every byte of b other than the
+// unreserved characters of RFC 3986. Unlike url.QueryEscape,
+// a space is not encoded as '+', which trackers may not
+// decode within binary values.
+func escape(b []byte) string {
+	const hex = "0123456789ABCDEF"
+	s := make([]byte, 0, 3*len(b))
+	for _, c := range b {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~':
+			s = append(s, c)
+		default:
+			s = append(s, '%', hex[c>>4], hex[c&15])
+		}
+	}
+	return string(s)
+}
+
+// addQuery appends query to the query of rawurl.
+func addQuery(rawurl, query string) string {
+	if i := strings.IndexByte(rawurl, '#'); i >= 0 {
+		rawurl = rawurl[:i]
+	}
+	switch {
+	case !strings.Contains(rawurl, "?"):
+		return rawurl + "?" + query
+	case strings.HasSuffix(rawurl, "?"), strings.HasSuffix(rawurl, "&"):
+		return rawurl + query
+	}
+	return rawurl + "&" + query
+}
+
+// ScrapeURL returns the scrape URL of an announce URL, found by
+// replacing "announce" at the start of its last path element with
+// "scrape". It returns an error if the tracker cannot be scraped.
+func ScrapeURL(announce string) (string, error) {
+	path := announce
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	i := strings.LastIndexByte(path, '/')
+	if i < 0 || !strings.HasPrefix(path[i+1:], "announce") {
+		return "", fmt.Errorf("tracker: cannot scrape %s", announce)
+	}
+	return announce[:i+1] + "scrape" + announce[i+1+len("announce"):], nil
+}
+
+// A FailureError is the failure reason of a tracker response.
+type FailureError string
+
+func (e FailureError) Error() string {
+	return "tracker: failure: " + string(e)
+}
+
+// A Client makes requests to HTTP trackers.
+type Client struct {
+	// HTTPClient is used to make requests.
+	// If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// UserAgent, if not empty, is sent with each request.
+	UserAgent string
+}
+
+// Announce sends r to the tracker at announce. A response with
+// a failure reason is returned as a FailureError.
+func (c *Client) Announce(ctx context.Context, announce string, r *AnnounceRequest) (*Response, error) {
+	resp := new(Response)
+	if err := c.get(ctx, addQuery(announce, r.Query()), resp); err != nil {
+		return nil, err
+	}
+	if resp.FailureReason != "" {
+		return nil, FailureError(resp.FailureReason)
+	}
+	return resp, nil
+}
+
+// Scrape requests the state of the swarms of infoHashes from the
+// tracker at announce. If no info-hashes are given, the tracker
+// may describe all of its swarms.
+func (c *Client) Scrape(ctx context.Context, announce string, infoHashes ...[20]byte) (*ScrapeResponse, error) {
+	u, err := ScrapeURL(announce)
+	if err != nil {
+		return nil, err
+	}
+	if len(infoHashes) > 0 {
+		q := make([]string, len(infoHashes))
+		for i := range infoHashes {
+			q[i] = "info_hash=" + escape(infoHashes[i][:])
+		}
+		u = addQuery(u, strings.Join(q, "&"))
+	}
+	resp := new(ScrapeResponse)
+	if err = c.get(ctx, u, resp); err != nil {
+		return nil, err
+	}
+	if resp.FailureReason != "" {
+		return nil, FailureError(resp.FailureReason)
+	}
+	return resp, nil
+}
+
+// maxResponse limits the length of a response body.
+const maxResponse = 4 << 20
+
+// get fetches u and decodes the body of the response into v.
+func (c *Client) get(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return err
+	}
+	if err = bencode.Unmarshal(b, v); err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("tracker: %s", resp.Status)
+		}
+		return fmt.Errorf("tracker: invalid response: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package tracker
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// Defaults of the Server settings.
+const (
+	DefaultInterval = 30 * time.Minute
+	DefaultNumWant  = 50
+	maxNumWant      = 200
+)
+
+// A Server is an in-memory HTTP tracker. It answers announces
+// at paths whose last element begins with "announce" and
+// scrapes at paths whose last element begins with "scrape".
+// The zero value is a tracker for any torrent.
+//
+// Peers are given the address the request came from, and are
+// forgotten if they do not announce for twice the interval.
+type Server struct {
+	// Interval is sent to clients as the announce interval.
+	// If zero, DefaultInterval is used.
+	Interval time.Duration
+
+	// MinInterval, if not zero, is sent as the minimum interval.
+	MinInterval time.Duration
+
+	// NumWant is the number of peers returned when
+	// a client does not ask for a number.
+	// If zero, DefaultNumWant is used.
+	NumWant int
+
+	// Allow, if not nil, is called with each announced
+	// info-hash and rejects the announce if it returns false.
+	Allow func(infoHash [20]byte) bool
+
+	mu     sync.Mutex
+	swarms map[[20]byte]*swarm
+}
+
+type swarm struct {
+	peers      map[string]*peer // by peer ID
+	downloaded int64
+}
+
+type peer struct {
+	Peer
+	left int64
+	seen time.Time
+}
+
+// ServeHTTP answers an announce or a scrape.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch base := path.Base(r.URL.Path); {
+	case strings.HasPrefix(base, "announce"):
+		s.announce(w, r)
+	case strings.HasPrefix(base, "scrape"):
+		s.scrape(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) interval() time.Duration {
+	if s.Interval > 0 {
+		return s.Interval
+	}
+	return DefaultInterval
+}
+
+// fail writes a response with only a failure reason.
+func fail(w http.ResponseWriter, reason string) {
+	write(w, map[string]string{"failure reason": reason})
+}
+
+func write(w http.ResponseWriter, v interface{}) {
+	b, err := bencode.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write(b)
+}
+
+// parseInfoHash returns v as an info-hash.
+func parseInfoHash(v string) (h [20]byte, ok bool) {
+	if len(v) != len(h) {
+		return h, false
+	}
+	copy(h[:], v)
+	return h, true
+}
+
+func (s *Server) announce(w http.ResponseWriter, r *http.Request) {
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		fail(w, "invalid query")
+		return
+	}
+	ih, ok := parseInfoHash(q.Get("info_hash"))
+	if !ok {
+		fail(w, "invalid info_hash")
+		return
+	}
+	id := q.Get("peer_id")
+	if len(id) != 20 {
+		fail(w, "invalid peer_id")
+		return
+	}
+	port, err := strconv.Atoi(q.Get("port"))
+	if err != nil || port <= 0 || port > 0xffff {
+		fail(w, "invalid port")
+		return
+	}
+	left, err := strconv.ParseInt(q.Get("left"), 10, 64)
+	if err != nil || left < 0 {
+		fail(w, "invalid left")
+		return
+	}
+	numWant := s.NumWant
+	if numWant <= 0 {
+		numWant = DefaultNumWant
+	}
+	if v := q.Get("numwant"); v != "" {
+		if numWant, err = strconv.Atoi(v); err != nil || numWant < 0 {
+			fail(w, "invalid numwant")
+			return
+		}
+		if numWant > maxNumWant {
+			numWant = maxNumWant
+		}
+	}
+	if s.Allow != nil && !s.Allow(ih) {
+		fail(w, "unregistered torrent")
+		return
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	now := time.Now()
+	resp := &Response{Interval: int64(s.interval() / time.Second)}
+	if s.MinInterval > 0 {
+		resp.MinInterval = int64(s.MinInterval / time.Second)
+	}
+
+	s.mu.Lock()
+	if s.swarms == nil {
+		s.swarms = make(map[[20]byte]*swarm)
+	}
+	sw := s.swarms[ih]
+	if sw == nil {
+		sw = &swarm{peers: make(map[string]*peer)}
+		s.swarms[ih] = sw
+	}
+	sw.expire(now.Add(-2 * s.interval()))
+
+	switch q.Get("event") {
+	case EventStopped:
+		delete(sw.peers, id)
+	case EventCompleted:
+		if p := sw.peers[id]; p == nil || p.left > 0 {
+			sw.downloaded++
+		}
+		fallthrough
+	default:
+		sw.peers[id] = &peer{Peer{id, host, port}, left, now}
+	}
+
+	for pid, p := range sw.peers {
+		if p.left == 0 {
+			resp.Complete++
+		} else {
+			resp.Incomplete++
+		}
+		// Seeders are not sent to other seeders.
+		if pid == id || left == 0 && p.left == 0 || len(resp.Peers) >= numWant {
+			continue
+		}
+		resp.Peers = append(resp.Peers, p.Peer)
+	}
+	s.mu.Unlock()
+
+	if q.Get("compact") != "1" {
+		if q.Get("no_peer_id") == "1" {
+			for i := range resp.Peers {
+				resp.Peers[i].ID = ""
+			}
+		}
+		write(w, resp)
+		return
+	}
+	var peers CompactPeers
+	for _, p := range resp.Peers {
+		if compactIP(p.IP, net.IPv4len) != nil {
+			peers = append(peers, p)
+		} else {
+			resp.Peers6 = append(resp.Peers6, p)
+		}
+	}
+	write(w, &compactResponse{resp, peers})
+}
+
+// expire removes the peers last seen before t.
+func (sw *swarm) expire(t time.Time) {
+	for id, p := range sw.peers {
+		if p.seen.Before(t) {
+			delete(sw.peers, id)
+		}
+	}
+}
+
+func (s *Server) scrape(w http.ResponseWriter, r *http.Request) {
+	q, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		fail(w, "invalid query")
+		return
+	}
+	var hashes [][20]byte
+	for _, v := range q["info_hash"] {
+		ih, ok := parseInfoHash(v)
+		if !ok {
+			fail(w, "invalid info_hash")
+			return
+		}
+		hashes = append(hashes, ih)
+	}
+
+	resp := &ScrapeResponse{Files: make(map[string]ScrapeFile)}
+	expired := time.Now().Add(-2 * s.interval())
+	s.mu.Lock()
+	if len(hashes) == 0 {
+		for ih := range s.swarms {
+			hashes = append(hashes, ih)
+		}
+	}
+	for _, ih := range hashes {
+		var f ScrapeFile
+		if sw := s.swarms[ih]; sw != nil {
+			sw.expire(expired)
+			for _, p := range sw.peers {
+				if p.left == 0 {
+					f.Complete++
+				} else {
+					f.Incomplete++
+				}
+			}
+			f.Downloaded = sw.downloaded
+		}
+		resp.Files[string(ih[:])] = f
+	}
+	s.mu.Unlock()
+	write(w, resp)
+}
@@ -0,0 +1,180 @@
+// Package tracker implements the HTTP tracker protocol of BEP 3,
+// with the compact peer lists of BEP 23 and BEP 7 and the
+// scrape convention of BEP 48.
+package tracker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+// A Response is the bencoded reply to an announce.
+type Response struct {
+	// FailureReason is set if the announce failed,
+	// in which case no other field is present.
+	FailureReason  string `bencode:"failure reason,omitempty"`
+	WarningMessage string `bencode:"warning message,omitempty"`
+
+	// Interval is the number of seconds the client should wait
+	// between regular announces, and MinInterval the shortest
+	// wait it may use.
+	Interval    int64 `bencode:"interval,omitempty"`
+	MinInterval int64 `bencode:"min interval,omitempty"`
+
+	// TrackerID is to be sent with the next announces.
+	TrackerID string `bencode:"tracker id,omitempty"`
+
+	Complete   int64 `bencode:"complete,omitempty"`   // number of seeders
+	Incomplete int64 `bencode:"incomplete,omitempty"` // number of leechers
+
+	Peers  Peers         `bencode:"peers"`
+	Peers6 CompactPeers6 `bencode:"peers6,omitempty"`
+}
+
+// compactResponse encodes the peers of a Response in compact form.
+type compactResponse struct {
+	*Response
+	Peers CompactPeers `bencode:"peers"`
+}
+
+// A ScrapeResponse is the bencoded reply to a scrape.
+type ScrapeResponse struct {
+	FailureReason string `bencode:"failure reason,omitempty"`
+
+	// Files maps binary info-hashes to the state of their swarms.
+	Files map[string]ScrapeFile `bencode:"files"`
+}
+
+// ScrapeFile describes the swarm of a torrent.
+type ScrapeFile struct {
+	Complete   int64  `bencode:"complete"`   // number of seeders
+	Downloaded int64  `bencode:"downloaded"` // number of completed downloads
+	Incomplete int64  `bencode:"incomplete"` // number of leechers
+	Name       string `bencode:"name,omitempty"`
+}
+
+// A Peer is a member of a swarm. IP is an IP address
+// or a DNS name, as sent in the dictionary form.
+type Peer struct {
+	ID   string `bencode:"peer id,omitempty"`
+	IP   string `bencode:"ip"`
+	Port int    `bencode:"port"`
+}
+
+func (p Peer) String() string {
+	return net.JoinHostPort(p.IP, strconv.Itoa(p.Port))
+}
+
+// Peers is a list of peers, encoded as a list of dictionaries.
+// Either that form or the compact form of CompactPeers is
+// decoded.
+type Peers []Peer
+
+// MarshalBencode encodes p as a list of dictionaries.
+func (p Peers) MarshalBencode() ([]byte, error) {
+	if p == nil {
+		return []byte("le"), nil
+	}
+	return bencode.Marshal([]Peer(p))
+}
+
+// UnmarshalBencode decodes a list of dictionaries
+// or a compact string into p.
+func (p *Peers) UnmarshalBencode(b []byte) error {
+	if len(b) > 0 && b[0] == 'l' {
+		var l []Peer
+		if err := bencode.Unmarshal(b, &l); err != nil {
+			return err
+		}
+		*p = l
+		return nil
+	}
+	var c CompactPeers
+	if err := c.UnmarshalBencode(b); err != nil {
+		return err
+	}
+	*p = Peers(c)
+	return nil
+}
+
+// CompactPeers is a list of IPv4 peers, encoded as a string
+// of concatenated 6 byte addresses. Peer IDs are not encoded.
+type CompactPeers []Peer
+
+// CompactPeers6 is a list of IPv6 peers, encoded as a
+// string of concatenated 18 byte addresses.
+type CompactPeers6 []Peer
+
+// MarshalBencode encodes p as a compact string.
+func (p CompactPeers) MarshalBencode() ([]byte, error) {
+	return marshalCompact(p, net.IPv4len)
+}
+
+// UnmarshalBencode decodes a compact string into p.
+func (p *CompactPeers) UnmarshalBencode(b []byte) error {
+	peers, err := unmarshalCompact(b, net.IPv4len)
+	*p = peers
+	return err
+}
+
+// MarshalBencode encodes p as a compact string.
+func (p CompactPeers6) MarshalBencode() ([]byte, error) {
+	return marshalCompact(p, net.IPv6len)
+}
+
+// UnmarshalBencode decodes a compact string into p.
+func (p *CompactPeers6) UnmarshalBencode(b []byte) error {
+	peers, err := unmarshalCompact(b, net.IPv6len)
+	*p = peers
+	return err
+}
+
+// compactIP returns the ipLen byte form of s, or nil
+// if s is not an IP address of that family.
+func compactIP(s string, ipLen int) net.IP {
+	ip := net.ParseIP(s)
+	ip4 := ip.To4()
+	switch {
+	case ipLen == net.IPv4len:
+		return ip4
+	case ip4 != nil:
+		return nil
+	}
+	return ip
+}
+
+func marshalCompact(peers []Peer, ipLen int) ([]byte, error) {
+	s := make([]byte, 0, len(peers)*(ipLen+2))
+	for _, p := range peers {
+		ip := compactIP(p.IP, ipLen)
+		if ip == nil {
+			return nil, fmt.Errorf("tracker: peer address %q does not fit in %d bytes", p.IP, ipLen)
+		}
+		s = append(s, ip...)
+		s = append(s, byte(p.Port>>8), byte(p.Port))
+	}
+	return bencode.Marshal(s)
+}
+
+func unmarshalCompact(b []byte, ipLen int) ([]Peer, error) {
+	var s []byte
+	if err := bencode.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	size := ipLen + 2
+	if len(s)%size != 0 {
+		return nil, fmt.Errorf("tracker: compact peers have length %d", len(s))
+	}
+	var peers []Peer
+	for ; len(s) > 0; s = s[size:] {
+		peers = append(peers, Peer{
+			IP:   net.IP(s[:ipLen]).String(),
+			Port: int(binary.BigEndian.Uint16(s[ipLen:size])),
+		})
+	}
+	return peers, nil
+}
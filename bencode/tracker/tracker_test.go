@@ -0,0 +1,181 @@
+package tracker
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/ehmry/encoding/bencode"
+)
+
+func TestEscape(t *testing.T) {
+	in := []byte{0x12, 0x34, 'a', ' ', '+', '~', 0xff}
+	if got, want := escape(in), "%124a%20%2B~%FF"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	q, err := url.ParseQuery("info_hash=" + escape(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.Get("info_hash"); got != string(in) {
+		t.Errorf("round trip: got %q", got)
+	}
+}
+
+func TestScrapeURL(t *testing.T) {
+	for _, tt := range []struct{ in, out string }{
+		{"http://example.com/announce", "http://example.com/scrape"},
+		{"http://example.com/x/announce", "http://example.com/x/scrape"},
+		{"http://example.com/announce.php", "http://example.com/scrape.php"},
+		{"http://example.com/announce?x2%0644", "http://example.com/scrape?x2%0644"},
+		{"http://example.com/a", ""},
+		{"http://example.com/announce/x", ""},
+		{"http://example.com/x%064announce", ""},
+	} {
+		out, err := ScrapeURL(tt.in)
+		if out != tt.out || (err == nil) != (tt.out != "") {
+			t.Errorf("ScrapeURL(%q) = %q, %v; want %q", tt.in, out, err, tt.out)
+		}
+	}
+}
+
+func TestPeers(t *testing.T) {
+	want := Peers{{IP: "10.0.0.1", Port: 6881}, {IP: "192.168.1.2", Port: 80}}
+	for _, in := range []string{
+		"d5:peers12:\x0a\x00\x00\x01\x1a\xe1\xc0\xa8\x01\x02\x00\x50e",
+		"d5:peersld2:ip8:10.0.0.14:porti6881eed2:ip11:192.168.1.24:porti80eeee",
+	} {
+		var resp Response
+		if err := bencode.Unmarshal([]byte(in), &resp); err != nil {
+			t.Errorf("%q: %s", in, err)
+			continue
+		}
+		if !reflect.DeepEqual(resp.Peers, want) {
+			t.Errorf("%q: got %v, want %v", in, resp.Peers, want)
+		}
+	}
+
+	b, err := bencode.Marshal(&compactResponse{&Response{Interval: 60}, CompactPeers(want)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "d8:intervali60e5:peers12:\x0a\x00\x00\x01\x1a\xe1\xc0\xa8\x01\x02\x00\x50e"; string(b) != want {
+		t.Errorf("compact: got %q, want %q", b, want)
+	}
+
+	var p6 CompactPeers6
+	b, err = bencode.Marshal(CompactPeers6{{IP: "2001:db8::1", Port: 1}})
+	if err == nil {
+		err = bencode.Unmarshal(b, &p6)
+	}
+	if err != nil || len(p6) != 1 || p6[0].IP != "2001:db8::1" || p6[0].Port != 1 {
+		t.Errorf("peers6: got %v, %v", p6, err)
+	}
+	if _, err = bencode.Marshal(CompactPeers{{IP: "::1", Port: 1}}); err == nil {
+		t.Error("IPv6 peer encoded as CompactPeers")
+	}
+	if _, err = bencode.Marshal(CompactPeers6{{IP: "10.0.0.1", Port: 1}}); err == nil {
+		t.Error("IPv4 peer encoded as CompactPeers6")
+	}
+}
+
+func peerID(c byte) (id [20]byte) {
+	for i := range id {
+		id[i] = c
+	}
+	return id
+}
+
+func ports(peers Peers) []int {
+	var p []int
+	for _, peer := range peers {
+		p = append(p, peer.Port)
+	}
+	sort.Ints(p)
+	return p
+}
+
+func TestSwarm(t *testing.T) {
+	ts := httptest.NewServer(new(Server))
+	defer ts.Close()
+	announce := ts.URL + "/announce"
+	ctx := context.Background()
+	var c Client
+
+	// A binary info-hash with bytes that need escaping.
+	ih := [20]byte{0x00, ' ', '+', '&', '%', 0xff}
+	req := func(id byte, port int, left int64, event string) *AnnounceRequest {
+		return &AnnounceRequest{InfoHash: ih, PeerID: peerID(id), Port: port, Left: left, Event: event}
+	}
+
+	resp, err := c.Announce(ctx, announce, req('s', 1001, 0, EventStarted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Peers) != 0 || resp.Complete != 1 || resp.Interval != 1800 {
+		t.Errorf("first announce: got %+v", resp)
+	}
+
+	if _, err = c.Announce(ctx, announce, req('a', 1002, 100, EventStarted)); err != nil {
+		t.Fatal(err)
+	}
+	if resp, err = c.Announce(ctx, announce, req('b', 1003, 100, EventStarted)); err != nil {
+		t.Fatal(err)
+	}
+	if p := ports(resp.Peers); !reflect.DeepEqual(p, []int{1001, 1002}) || resp.Complete != 1 || resp.Incomplete != 2 {
+		t.Errorf("leecher announce: got %+v", resp)
+	}
+	if resp.Peers[0].ID != "" || resp.Peers[0].IP != "127.0.0.1" {
+		t.Errorf("compact peer: got %+v", resp.Peers[0])
+	}
+
+	// Seeders are given only leechers.
+	r := req('a', 1002, 0, EventCompleted)
+	r.NoCompact = true
+	if resp, err = c.Announce(ctx, announce, r); err != nil {
+		t.Fatal(err)
+	}
+	if p := ports(resp.Peers); !reflect.DeepEqual(p, []int{1003}) || resp.Complete != 2 {
+		t.Errorf("completed announce: got %+v", resp)
+	}
+	if id := peerID('b'); resp.Peers[0].ID != string(id[:]) {
+		t.Errorf("dictionary peer: got %+v", resp.Peers[0])
+	}
+
+	if _, err = c.Announce(ctx, announce, req('b', 1003, 100, EventStopped)); err != nil {
+		t.Fatal(err)
+	}
+
+	other := [20]byte{1}
+	sr, err := c.Scrape(ctx, announce, ih, other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ScrapeFile{
+		string(ih[:]):    {Complete: 2, Downloaded: 1},
+		string(other[:]): {},
+	}
+	if !reflect.DeepEqual(sr.Files, want) {
+		t.Errorf("scrape: got %+v, want %+v", sr.Files, want)
+	}
+	if sr, err = c.Scrape(ctx, announce); err != nil || len(sr.Files) != 1 {
+		t.Errorf("scrape all: got %+v, %v", sr, err)
+	}
+}
+
+func TestFailure(t *testing.T) {
+	ts := httptest.NewServer(&Server{Allow: func([20]byte) bool { return false }})
+	defer ts.Close()
+	var c Client
+	_, err := c.Announce(context.Background(), ts.URL+"/announce", &AnnounceRequest{Port: 1})
+	if _, ok := err.(FailureError); !ok {
+		t.Errorf("got %v, want FailureError", err)
+	}
+	_, err = c.Announce(context.Background(), ts.URL+"/x", &AnnounceRequest{Port: 1})
+	if err == nil {
+		t.Error("announce to missing path succeeded")
+	}
+}
@@ -0,0 +1,395 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Kind is the type of a Value.
+type Kind int
+
+const (
+	KindInt Kind = iota + 1
+	KindBytes
+	KindList
+	KindDict
+)
+
+var kindNames = [...]string{
+	KindInt:   "integer",
+	KindBytes: "string",
+	KindList:  "list",
+	KindDict:  "dictionary",
+}
+
+func (k Kind) String() string {
+	if k > 0 && int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// A Value is a bencode value that keeps the order of dictionary
+// keys and the original encoding of integers and strings, so that
+// a parsed Value that has not been modified encodes to the bytes it
+// was parsed from, even if they are not in canonical form.
+//
+// A Value is modified with its methods, which discard the original
+// encoding of what they change and nothing else.
+type Value struct {
+	kind  Kind
+	i     int64
+	bytes []byte
+	list  []*Value
+	dict  []entry
+
+	// raw is the original encoding of an integer or string.
+	raw []byte
+}
+
+// An entry is a key and value of a dictionary.
+type entry struct {
+	key    string
+	rawKey []byte // original encoding of key
+	value  *Value
+}
+
+// NewInt returns an integer Value.
+func NewInt(i int64) *Value { return &Value{kind: KindInt, i: i} }
+
+// NewBytes returns a string Value holding a copy of b.
+func NewBytes(b []byte) *Value {
+	return &Value{kind: KindBytes, bytes: append([]byte{}, b...)}
+}
+
+// NewString returns a string Value holding s.
+func NewString(s string) *Value { return &Value{kind: KindBytes, bytes: []byte(s)} }
+
+// NewList returns a list Value of elems.
+func NewList(elems ...*Value) *Value {
+	return &Value{kind: KindList, list: append([]*Value{}, elems...)}
+}
+
+// NewDict returns an empty dictionary Value.
+func NewDict() *Value { return &Value{kind: KindDict} }
+
+// NewValue returns the Value of the bencoding of x, as by Marshal.
+func NewValue(x interface{}) (*Value, error) {
+	b, err := Marshal(x)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses data, which must hold a single bencode value.
+// The Value does not refer to data.
+func Parse(data []byte) (*Value, error) {
+	var scan scanner
+	if err := checkValue(data, &scan, false); err != nil {
+		return nil, err
+	}
+	p := valueParser{data: append([]byte{}, data...)}
+	return p.value()
+}
+
+// valueParser parses valid bencode data into a Value.
+type valueParser struct {
+	data []byte
+	off  int
+}
+
+func (p *valueParser) value() (*Value, error) {
+	start := p.off
+	switch c := p.data[p.off]; {
+	case c == 'i':
+		end := p.off + bytes.IndexByte(p.data[p.off:], 'e')
+		s := string(p.data[p.off+1 : end])
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			// An integer too large for an int64 is kept
+			// in raw, and returned in full by Number.
+			if err.(*strconv.NumError).Err != strconv.ErrRange {
+				return nil, &SyntaxError{"invalid integer " + s, int64(p.off)}
+			}
+			i = 0
+		}
+		p.off = end + 1
+		return &Value{kind: KindInt, i: i, raw: p.data[start:p.off]}, nil
+
+	case c == 'l':
+		v := NewList()
+		for p.off++; p.data[p.off] != 'e'; {
+			elem, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			v.list = append(v.list, elem)
+		}
+		p.off++
+		return v, nil
+
+	case c == 'd':
+		v := NewDict()
+		for p.off++; p.data[p.off] != 'e'; {
+			keyStart := p.off
+			key := p.string()
+			e := entry{key: string(key), rawKey: p.data[keyStart:p.off]}
+			var err error
+			if e.value, err = p.value(); err != nil {
+				return nil, err
+			}
+			v.dict = append(v.dict, e)
+		}
+		p.off++
+		return v, nil
+	}
+	b := p.string()
+	return &Value{kind: KindBytes, bytes: b, raw: p.data[start:p.off]}, nil
+}
+
+// string returns the string at p.off.
+func (p *valueParser) string() []byte {
+	colon := p.off + bytes.IndexByte(p.data[p.off:], ':')
+	n, _ := strconv.Atoi(string(p.data[p.off:colon]))
+	p.off = colon + 1 + n
+	return p.data[colon+1 : p.off]
+}
+
+// Kind returns the kind of v.
+func (v *Value) Kind() Kind { return v.kind }
+
+// Int returns the integer of v, or 0 if v is not an integer
+// or is one that does not fit in an int64.
+func (v *Value) Int() int64 { return v.i }
+
+// Number returns the decimal form of the integer of v, which
+// may be too large for an int64, or "" if v is not an integer.
+func (v *Value) Number() Number {
+	if v.kind != KindInt {
+		return ""
+	}
+	if v.raw != nil {
+		return Number(v.raw[1 : len(v.raw)-1])
+	}
+	return Number(strconv.FormatInt(v.i, 10))
+}
+
+// Bytes returns the string of v, or nil if v is not a string.
+// The result must not be modified.
+func (v *Value) Bytes() []byte { return v.bytes }
+
+// Len returns the length of a string, or the number of
+// elements of a list or entries of a dictionary.
+func (v *Value) Len() int {
+	switch v.kind {
+	case KindBytes:
+		return len(v.bytes)
+	case KindList:
+		return len(v.list)
+	case KindDict:
+		return len(v.dict)
+	}
+	return 0
+}
+
+// Index returns element i of a list, or nil if there is none.
+func (v *Value) Index(i int) *Value {
+	if v.kind != KindList || i < 0 || i >= len(v.list) {
+		return nil
+	}
+	return v.list[i]
+}
+
+// Keys returns the keys of a dictionary, in order.
+func (v *Value) Keys() []string {
+	keys := make([]string, len(v.dict))
+	for i, e := range v.dict {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+// find returns the index of the first entry with key, or -1.
+func (v *Value) find(key string) int {
+	for i, e := range v.dict {
+		if e.key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// Get returns the value of key in a dictionary, or nil if there is none.
+func (v *Value) Get(key string) *Value {
+	if i := v.find(key); i >= 0 {
+		return v.dict[i].value
+	}
+	return nil
+}
+
+// Lookup returns the value at path below v, or nil if there is none.
+// Each element of path is a string, the key of a dictionary entry,
+// or an int, the index of a list element.
+func (v *Value) Lookup(path ...interface{}) *Value {
+	for _, elem := range path {
+		switch elem := elem.(type) {
+		case string:
+			if v.kind != KindDict {
+				return nil
+			}
+			v = v.Get(elem)
+		case int:
+			v = v.Index(elem)
+		default:
+			return nil
+		}
+		if v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// SetInt makes v the integer i.
+func (v *Value) SetInt(i int64) { *v = Value{kind: KindInt, i: i} }
+
+// SetBytes makes v a string holding a copy of b.
+func (v *Value) SetBytes(b []byte) { *v = *NewBytes(b) }
+
+// SetString makes v the string s.
+func (v *Value) SetString(s string) { *v = *NewString(s) }
+
+// errKind returns an error for an operation on
+// a Value that requires kind.
+func (v *Value) errKind(kind Kind) error {
+	return fmt.Errorf("bencode: Value is a %s, not a %s", v.kind, kind)
+}
+
+// Append appends elems to a list.
+func (v *Value) Append(elems ...*Value) error {
+	if v.kind != KindList {
+		return v.errKind(KindList)
+	}
+	v.list = append(v.list, elems...)
+	return nil
+}
+
+// SetIndex replaces element i of a list with elem.
+func (v *Value) SetIndex(i int, elem *Value) error {
+	if v.kind != KindList {
+		return v.errKind(KindList)
+	}
+	if i < 0 || i >= len(v.list) {
+		return errors.New("bencode: list index " + strconv.Itoa(i) + " out of range")
+	}
+	v.list[i] = elem
+	return nil
+}
+
+// RemoveIndex removes element i of a list.
+func (v *Value) RemoveIndex(i int) error {
+	if v.kind != KindList {
+		return v.errKind(KindList)
+	}
+	if i < 0 || i >= len(v.list) {
+		return errors.New("bencode: list index " + strconv.Itoa(i) + " out of range")
+	}
+	v.list = append(v.list[:i], v.list[i+1:]...)
+	return nil
+}
+
+// Set sets the value of key in a dictionary. An existing entry keeps
+// its place, and a new entry is inserted before the first key that
+// sorts after it, so that a dictionary in canonical order stays so.
+func (v *Value) Set(key string, value *Value) error {
+	if v.kind != KindDict {
+		return v.errKind(KindDict)
+	}
+	if i := v.find(key); i >= 0 {
+		v.dict[i].value = value
+		return nil
+	}
+	i := 0
+	for i < len(v.dict) && v.dict[i].key < key {
+		i++
+	}
+	v.dict = append(v.dict, entry{})
+	copy(v.dict[i+1:], v.dict[i:])
+	v.dict[i] = entry{key: key, value: value}
+	return nil
+}
+
+// Delete removes key from a dictionary.
+func (v *Value) Delete(key string) error {
+	if v.kind != KindDict {
+		return v.errKind(KindDict)
+	}
+	if i := v.find(key); i >= 0 {
+		v.dict = append(v.dict[:i], v.dict[i+1:]...)
+	}
+	return nil
+}
+
+// Encode returns the bencoding of v.
+func (v *Value) Encode() []byte {
+	return v.appendEncoding(nil)
+}
+
+func (v *Value) appendEncoding(b []byte) []byte {
+	if v.raw != nil {
+		return append(b, v.raw...)
+	}
+	switch v.kind {
+	case KindInt:
+		b = AppendInt(b, v.i)
+	case KindBytes:
+		b = AppendBytes(b, v.bytes)
+	case KindList:
+		b = append(b, 'l')
+		for _, elem := range v.list {
+			b = elem.appendEncoding(b)
+		}
+		b = append(b, 'e')
+	case KindDict:
+		b = append(b, 'd')
+		for _, e := range v.dict {
+			if e.rawKey != nil {
+				b = append(b, e.rawKey...)
+			} else {
+				b = AppendString(b, e.key)
+			}
+			b = e.value.appendEncoding(b)
+		}
+		b = append(b, 'e')
+	default:
+		// The zero Value encodes as an empty string.
+		b = append(b, '0', ':')
+	}
+	return b
+}
+
+// Decode stores the value of v in the value pointed to by x, as by Unmarshal.
+func (v *Value) Decode(x interface{}) error {
+	return Unmarshal(v.Encode(), x)
+}
+
+// MarshalBencode returns the bencoding of v.
+func (v Value) MarshalBencode() ([]byte, error) {
+	return v.Encode(), nil
+}
+
+// UnmarshalBencode sets v to the Value parsed from b.
+func (v *Value) UnmarshalBencode(b []byte) error {
+	p, err := Parse(b)
+	if err != nil {
+		return err
+	}
+	*v = *p
+	return nil
+}
+
+var _ Marshaler = Value{}
+var _ Unmarshaler = (*Value)(nil)
@@ -4,11 +4,13 @@
 // Package yijing64 implements radix 64 Yijing encoding and decoding.
 package yijing
 
+import "strconv"
+
 // ䷀ 0xE4 0xB7 0x80
 // ䷿ 0xE4 0xB7 0xBF
 
 // ☰ 0xE2 0x98 0xb0
-// ☷ 0xE2 0x98 0xb8
+// ☷ 0xE2 0x98 0xb7
 
 // ǀ 0xC7 0x80
 // ¦ 0xC2 0xa6
@@ -54,7 +56,7 @@ func Encode(dst, src []byte) (n int) {
 			dst[7] = 0x98
 			dst[8] = 0xB0 | ((src[1] & 0x0F) >> 1)
 
-			if (src[1] & 0xFE) == 0 {
+			if (src[1] & 0x01) == 0 {
 				dst[9] = 0xC7
 				dst[10] = 0x80
 			} else {
@@ -88,7 +90,7 @@ func Encode(dst, src []byte) (n int) {
 
 		dst[6] = 0xE4
 		dst[7] = 0xB7
-		dst[8] = 0x80 | ((src[1] & 0x0F) << 2) | (src[2] >> 4)
+		dst[8] = 0x80 | ((src[1] & 0x0F) << 2) | (src[2] >> 6)
 
 		dst[9] = 0xE4
 		dst[10] = 0xB7
@@ -108,3 +110,132 @@ func EncodeToString(src []byte) string {
 	Encode(dst, src)
 	return string(dst)
 }
+
+// CorruptInputError values describe errors resulting from an invalid rune
+// in a Yi Jing string. The value is the byte offset of that rune.
+type CorruptInputError int64
+
+func (e CorruptInputError) Error() string {
+	return "illegal yijing data at input byte " + strconv.FormatInt(int64(e), 10)
+}
+
+// DecodedLen returns the length in bytes of the decoded data
+// corresponding to n bytes of Yi Jing encoded data.
+func DecodedLen(n int) (l int) {
+	l = (n / 12) * 3
+
+	switch n % 12 {
+	case 7:
+		l += 1
+	case 11:
+		l += 2
+	}
+	return l
+}
+
+// hexagram returns the six bits held by the hexagram at the start of src.
+func hexagram(src []byte) (byte, bool) {
+	if len(src) < 3 || src[0] != 0xE4 || src[1] != 0xB7 || (src[2]&0xC0) != 0x80 {
+		return 0, false
+	}
+	return src[2] & 0x3F, true
+}
+
+// trigram returns the three bits held by the trigram at the start of src.
+func trigram(src []byte) (byte, bool) {
+	if len(src) < 3 || src[0] != 0xE2 || src[1] != 0x98 || (src[2]&0xF8) != 0xB0 {
+		return 0, false
+	}
+	return src[2] & 0x07, true
+}
+
+// line returns the bit held by the ǀ or ¦ at the start of src.
+func line(src []byte) (byte, bool) {
+	switch {
+	case len(src) < 2:
+	case src[0] == 0xC7 && src[1] == 0x80:
+		return 0, true
+	case src[0] == 0xC2 && src[1] == 0xA6:
+		return 1, true
+	}
+	return 0, false
+}
+
+// Decode decodes src into DecodedLen(len(src)) bytes,
+// returning the actual number of bytes written to dst.
+//
+// If src contains invalid Yi Jing data, it will return the
+// number of bytes successfully written and CorruptInputError.
+func Decode(dst, src []byte) (n int, err error) {
+	var si int
+	for si < len(src) {
+		var h [4]byte
+		var j int
+		for ; j < 4; j++ {
+			b, ok := hexagram(src[si:])
+			if !ok {
+				break
+			}
+			h[j] = b
+			si += 3
+		}
+
+		switch j {
+		case 4:
+			dst[n] = (h[0] << 2) | (h[1] >> 4)
+			dst[n+1] = (h[1] << 4) | (h[2] >> 2)
+			dst[n+2] = (h[2] << 6) | h[3]
+			n += 3
+			continue
+
+		case 2:
+			t, ok := trigram(src[si:])
+			if !ok {
+				return n, CorruptInputError(si)
+			}
+			si += 3
+
+			l, ok := line(src[si:])
+			if !ok {
+				return n, CorruptInputError(si)
+			}
+			si += 2
+
+			dst[n] = (h[0] << 2) | (h[1] >> 4)
+			dst[n+1] = (h[1] << 4) | (t << 1) | l
+			n += 2
+
+		case 1:
+			l1, ok := line(src[si:])
+			if !ok {
+				return n, CorruptInputError(si)
+			}
+			si += 2
+
+			l0, ok := line(src[si:])
+			if !ok {
+				return n, CorruptInputError(si)
+			}
+			si += 2
+
+			dst[n] = (h[0] << 2) | (l1 << 1) | l0
+			n++
+
+		default:
+			return n, CorruptInputError(si)
+		}
+
+		// A partial group may only end the input.
+		if si < len(src) {
+			return n, CorruptInputError(si)
+		}
+	}
+	return n, nil
+}
+
+// DecodeString returns the bytes represented by the Yi Jing string s.
+func DecodeString(s string) ([]byte, error) {
+	dbuf := make([]byte, DecodedLen(len(s)))
+	n, err := Decode(dbuf, []byte(s))
+	return dbuf[:n], err
+}
@@ -1,6 +1,7 @@
 package yijing
 
 import (
+	"bytes"
 	"testing"
 )
 
@@ -15,10 +16,13 @@ var encDecTests = []encDecTest{
 	{"䷿¦¦", []byte{0xFF}},
 	{"䷀䷀☰ǀ", []byte{0x00, 0x00}},
 	{"䷿䷿☷¦", []byte{0xFF, 0xFF}},
+	{"䷀䷀☰¦", []byte{0x00, 0x01}},
+	{"䷀䷀☱ǀ", []byte{0x00, 0x02}},
 	{"䷀䷀䷀䷀", []byte{0x00, 0x00, 0x00}},
 	{"䷕䷕䷕䷕", []byte{0x55, 0x55, 0x55}},
 	{"䷪䷪䷪䷪", []byte{0xAA, 0xAA, 0xAA}},
 	{"䷿䷿䷿䷿", []byte{0xFF, 0xFF, 0xFF}},
+	{"䷀䷐䷈䷃", []byte{0x01, 0x02, 0x03}},
 	{"䷀䷀䷀䷀䷀䷀䷀䷀", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00}},
 	{"䷿䷿䷿䷿䷿䷿䷿䷿", []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}},
 }
@@ -36,6 +40,68 @@ func TestEncode(t *testing.T) {
 	}
 }
 
+func TestDecode(t *testing.T) {
+	for i, test := range encDecTests {
+		dst := make([]byte, DecodedLen(len(test.enc)))
+		n, err := Decode(dst, []byte(test.enc))
+		if err != nil {
+			t.Errorf("#%d: %q: %s", i, test.enc, err)
+			continue
+		}
+		if n != len(dst) {
+			t.Errorf("#%d: bad return value: got: %d want: %d", i, n, len(dst))
+		}
+		if !bytes.Equal(dst, test.dec) {
+			t.Errorf("#%d: got: %x want: %x", i, dst, test.dec)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	src := make([]byte, 256)
+	for i := range src {
+		src[i] = byte(i)
+	}
+	for l := 0; l < len(src); l++ {
+		dec, err := DecodeString(EncodeToString(src[l:]))
+		if err != nil {
+			t.Fatalf("length %d: %s", len(src)-l, err)
+		}
+		if !bytes.Equal(dec, src[l:]) {
+			t.Fatalf("length %d: got: %x want: %x", len(src)-l, dec, src[l:])
+		}
+	}
+}
+
+var corruptTests = []struct {
+	in     string
+	offset int64
+}{
+	{"a", 0},
+	{"䷀", 3},
+	{"䷀䷀䷀", 9},
+	{"䷀䷀ǀ", 6},
+	{"䷀ǀ", 5},
+	{"䷀ǀǀ䷀䷀䷀䷀", 7},
+	{"䷀䷀☰ǀǀ", 11},
+	{"䷀䷀䷀䷀☰", 12},
+	{"䷀䷀䷀\xe4\xb7", 9},
+}
+
+func TestDecodeCorrupt(t *testing.T) {
+	for i, test := range corruptTests {
+		_, err := DecodeString(test.in)
+		switch err := err.(type) {
+		case CorruptInputError:
+			if int64(err) != test.offset {
+				t.Errorf("#%d: %q: got offset %d, want %d", i, test.in, int64(err), test.offset)
+			}
+		default:
+			t.Errorf("#%d: %q: got error %v, want CorruptInputError", i, test.in, err)
+		}
+	}
+}
+
 func BenchmarkEncode(b *testing.B) {
 	var c byte
 	for i := 0; i < b.N; i++ {